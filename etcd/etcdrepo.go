@@ -0,0 +1,274 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	tokensync "github.com/tempcke/tk"
+)
+
+const (
+	// DefaultKey is the etcd key the token is stored under as a JSON blob.
+	DefaultKey = "tokensync/token"
+	// DefaultLockKey is the etcd key the Lock/Unlock mutex is created on.
+	DefaultLockKey = "tokensync/lock"
+	// DefaultLockTTLSeconds bounds the concurrency.Session backing
+	// Lock/Unlock, so a holder that dies loses the lock automatically.
+	DefaultLockTTLSeconds = 30
+)
+
+// ErrNoToken is returned by GetToken when no token has been stored yet.
+var ErrNoToken = errors.New("etcd: no token stored")
+
+// EtcdRepo implements tokensync.Repo (and tokensync.CASRepo) on top of
+// clientv3. GetOrCreate uses a ModRevision comparison for optimistic
+// concurrency; StoreToken overwrites the key with a plain Put and does no
+// such comparison. Lock/Unlock use concurrency.Mutex over a time-bounded
+// session so a dead holder's lock expires on its own.
+type EtcdRepo struct {
+	client      *clientv3.Client
+	key         string
+	lockKey     string
+	lockTTL     int
+	lockTimeout time.Duration
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*concurrency.Session
+	mutexes    map[string]*concurrency.Mutex
+}
+
+// Option configures an EtcdRepo built with NewEtcdRepo.
+type Option func(*EtcdRepo)
+
+// WithKey overrides the etcd key the token is stored under.
+func WithKey(key string) Option { return func(r *EtcdRepo) { r.key = key } }
+
+// WithLockKey overrides the etcd key the Lock/Unlock mutex is created on.
+func WithLockKey(lockKey string) Option { return func(r *EtcdRepo) { r.lockKey = lockKey } }
+
+// WithTTL overrides, in seconds, how long the concurrency.Session backing
+// Lock/Unlock is bounded to, so a holder that dies loses the lock sooner
+// or later than DefaultLockTTLSeconds.
+func WithTTL(seconds int) Option { return func(r *EtcdRepo) { r.lockTTL = seconds } }
+
+// WithLockTimeout bounds how long Lock will wait to acquire the mutex
+// before giving up with an error, instead of waiting until ctx is done.
+func WithLockTimeout(d time.Duration) Option { return func(r *EtcdRepo) { r.lockTimeout = d } }
+
+// NewEtcdRepo wraps an existing clientv3 client.
+func NewEtcdRepo(client *clientv3.Client, opts ...Option) (*EtcdRepo, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+
+	r := &EtcdRepo{
+		client:  client,
+		key:     DefaultKey,
+		lockKey: DefaultLockKey,
+		lockTTL: DefaultLockTTLSeconds,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// storedToken is the JSON shape persisted in etcd, matching
+// tokensync.Token's val/created/expires fields.
+type storedToken struct {
+	Val       string    `json:"val"`
+	CreatedAt time.Time `json:"created"`
+	ExpiresAt time.Time `json:"expires"`
+}
+
+func (t storedToken) String() string     { return t.Val }
+func (t storedToken) Created() time.Time { return t.CreatedAt }
+func (t storedToken) Expires() time.Time { return t.ExpiresAt }
+func (t storedToken) Validate() error    { return nil }
+
+func (r *EtcdRepo) GetToken(ctx context.Context, key string) (tokensync.Token, error) {
+	token, _, err := r.getToken(ctx, key)
+	return token, err
+}
+
+// keyFor namespaces the etcd key a token is stored under by the tokensync
+// key it belongs to, so one EtcdRepo can serve many named tokens without
+// their values colliding.
+func (r *EtcdRepo) keyFor(key string) string { return r.key + "/" + key }
+
+// lockKeyFor namespaces the etcd lock key the same way keyFor namespaces
+// the token key, so locking token A never blocks token B.
+func (r *EtcdRepo) lockKeyFor(key string) string { return r.lockKey + "/" + key }
+
+// getToken also returns the key's ModRevision so callers can guard a
+// follow-up write with a compare-and-swap.
+func (r *EtcdRepo) getToken(ctx context.Context, key string) (tokensync.Token, int64, error) {
+	resp, err := r.client.Get(ctx, r.keyFor(key))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, ErrNoToken
+	}
+
+	var token storedToken
+	if err := json.Unmarshal(resp.Kvs[0].Value, &token); err != nil {
+		return nil, 0, err
+	}
+	return token, resp.Kvs[0].ModRevision, nil
+}
+
+func (r *EtcdRepo) StoreToken(ctx context.Context, key string, token tokensync.Token) error {
+	raw, err := r.marshal(token)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Put(ctx, r.keyFor(key), string(raw))
+	return err
+}
+
+func (r *EtcdRepo) marshal(token tokensync.Token) ([]byte, error) {
+	return json.Marshal(storedToken{
+		Val:       token.String(),
+		CreatedAt: token.Created(),
+		ExpiresAt: token.Expires(),
+	})
+}
+
+// GetOrCreate implements tokensync.CASRepo. It reads the current token and
+// ModRevision, and if none is stored mints one via newToken and commits it
+// guarded by Compare(ModRevision(key), "=", rev). On conflict it returns
+// the winner's token instead of forcing the caller to re-mint.
+func (r *EtcdRepo) GetOrCreate(ctx context.Context, key string, newToken func() (tokensync.Token, error)) (tokensync.Token, error) {
+	etcdKey := r.keyFor(key)
+	for {
+		cur, rev, err := r.getToken(ctx, key)
+		if err == nil {
+			return cur, nil
+		}
+		if !errors.Is(err, ErrNoToken) {
+			return nil, err
+		}
+
+		tok, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := r.marshal(tok)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := r.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(etcdKey), "=", rev)).
+			Then(clientv3.OpPut(etcdKey, string(raw))).
+			Else(clientv3.OpGet(etcdKey)).
+			Commit()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Succeeded {
+			return tok, nil
+		}
+
+		// someone else won the race; accept their token instead of
+		// retrying the client call
+		if winner, ok := winnerFromTxn(resp); ok {
+			return winner, nil
+		}
+		// the winner's write raced with our read of it too; loop and retry
+	}
+}
+
+func winnerFromTxn(resp *clientv3.TxnResponse) (storedToken, bool) {
+	if len(resp.Responses) == 0 {
+		return storedToken{}, false
+	}
+	getResp := resp.Responses[0].GetResponseRange()
+	if getResp == nil || len(getResp.Kvs) == 0 {
+		return storedToken{}, false
+	}
+
+	var token storedToken
+	if err := json.Unmarshal(getResp.Kvs[0].Value, &token); err != nil {
+		return storedToken{}, false
+	}
+	return token, true
+}
+
+// Lock acquires a concurrency.Mutex for key over a session bounded by
+// DefaultLockTTLSeconds (or WithTTL), so a holder that dies before calling
+// Unlock loses the lock when its session expires. If WithLockTimeout was
+// set, Lock gives up with an error after that long instead of waiting
+// until ctx is done.
+func (r *EtcdRepo) Lock(ctx context.Context, key string) error {
+	lockCtx := ctx
+	if r.lockTimeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, r.lockTimeout)
+		defer cancel()
+	}
+
+	session, err := r.newSession(lockCtx, ctx)
+	if err != nil {
+		return err
+	}
+
+	mutex := concurrency.NewMutex(session, r.lockKeyFor(key))
+	if err := mutex.Lock(lockCtx); err != nil {
+		_ = session.Close()
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	if r.sessions == nil {
+		r.sessions = make(map[string]*concurrency.Session)
+		r.mutexes = make(map[string]*concurrency.Mutex)
+	}
+	r.sessions[key] = session
+	r.mutexes[key] = mutex
+	r.sessionsMu.Unlock()
+	return nil
+}
+
+// newSession grants a lease bounded by waitCtx and wraps it in a
+// concurrency.Session whose keepalive is bound to sessionCtx instead:
+// concurrency.NewSession has no separate deadline for the lease grant it
+// blocks on, so without granting the lease ourselves first, a slow or
+// unreachable etcd can hang Lock well past lockTimeout even before
+// mutex.Lock is ever called. Granting the lease directly, then handing it
+// to NewSession via WithLease, skips NewSession's own (unbounded) Grant
+// call — WithLease/WithContext only set up the keepalive stream, which
+// etcd's client keeps local bookkeeping for and does not block on. This
+// also keeps the session's keepalive running on sessionCtx, so a short
+// lockTimeout bounds only the grant here and doesn't also cut short the
+// keepalive of a session Lock already handed back to the caller.
+func (r *EtcdRepo) newSession(waitCtx, sessionCtx context.Context) (*concurrency.Session, error) {
+	resp, err := r.client.Grant(waitCtx, int64(r.lockTTL))
+	if err != nil {
+		return nil, err
+	}
+	return concurrency.NewSession(r.client,
+		concurrency.WithLease(resp.ID), concurrency.WithContext(sessionCtx))
+}
+
+func (r *EtcdRepo) Unlock(ctx context.Context, key string) error {
+	r.sessionsMu.Lock()
+	mutex, session := r.mutexes[key], r.sessions[key]
+	delete(r.mutexes, key)
+	delete(r.sessions, key)
+	r.sessionsMu.Unlock()
+
+	if mutex == nil {
+		return nil
+	}
+	err := mutex.Unlock(ctx)
+	_ = session.Close()
+	return err
+}
@@ -0,0 +1,128 @@
+package etcd_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	tokensync "github.com/tempcke/tk"
+	tketcd "github.com/tempcke/tk/etcd"
+)
+
+func TestEtcdRepo(t *testing.T) {
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_ENDPOINTS not set")
+	}
+
+	ctx := context.Background()
+
+	// EtcdRepo stores each token under its key + "/" + the tokensync key
+	storedKey := tketcd.DefaultKey + "/" + tokensync.DefaultKey
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	defer client.Delete(ctx, storedKey)
+
+	repo, err := tketcd.NewEtcdRepo(client)
+	require.NoError(t, err)
+
+	t.Run("get token from repo storage when there are no tokens", func(t *testing.T) {
+		client.Delete(ctx, storedKey)
+		_, err := repo.GetToken(ctx, tokensync.DefaultKey)
+		assert.ErrorIs(t, err, tketcd.ErrNoToken)
+	})
+
+	t.Run("store and get a token", func(t *testing.T) {
+		tok := newFakeToken()
+		require.NoError(t, repo.StoreToken(ctx, tokensync.DefaultKey, tok))
+
+		got, err := repo.GetToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+		assert.Equal(t, tok.String(), got.String())
+	})
+
+	t.Run("lock then unlock", func(t *testing.T) {
+		require.NoError(t, repo.Lock(ctx, tokensync.DefaultKey))
+		require.NoError(t, repo.Unlock(ctx, tokensync.DefaultKey))
+	})
+
+	t.Run("GetOrCreate mints once and lets a racing call observe it", func(t *testing.T) {
+		client.Delete(ctx, storedKey)
+		minted := 0
+		mint := func() (tokensync.Token, error) {
+			minted++
+			return newFakeToken(), nil
+		}
+
+		tok, err := repo.GetOrCreate(ctx, tokensync.DefaultKey, mint)
+		require.NoError(t, err)
+		assert.Equal(t, 1, minted)
+
+		again, err := repo.GetOrCreate(ctx, tokensync.DefaultKey, mint)
+		require.NoError(t, err)
+		assert.Equal(t, tok.String(), again.String())
+		assert.Equal(t, 1, minted)
+	})
+
+	t.Run("WithKey isolates storage from the default key", func(t *testing.T) {
+		defer client.Delete(ctx, "tokensync/token/custom/"+tokensync.DefaultKey)
+
+		custom, err := tketcd.NewEtcdRepo(client, tketcd.WithKey("tokensync/token/custom"))
+		require.NoError(t, err)
+
+		tok := newFakeToken()
+		require.NoError(t, custom.StoreToken(ctx, tokensync.DefaultKey, tok))
+
+		client.Delete(ctx, storedKey)
+		_, err = repo.GetToken(ctx, tokensync.DefaultKey)
+		assert.ErrorIs(t, err, tketcd.ErrNoToken)
+
+		got, err := custom.GetToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+		assert.Equal(t, tok.String(), got.String())
+	})
+
+	t.Run("WithLockTimeout gives up instead of waiting forever", func(t *testing.T) {
+		held, err := tketcd.NewEtcdRepo(client, tketcd.WithLockKey("tokensync/lock/custom"))
+		require.NoError(t, err)
+		require.NoError(t, held.Lock(ctx, tokensync.DefaultKey))
+		defer held.Unlock(ctx, tokensync.DefaultKey)
+
+		impatient, err := tketcd.NewEtcdRepo(client,
+			tketcd.WithLockKey("tokensync/lock/custom"), tketcd.WithLockTimeout(100*time.Millisecond))
+		require.NoError(t, err)
+
+		err = impatient.Lock(ctx, tokensync.DefaultKey)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+type fakeToken struct {
+	val     string
+	created time.Time
+	expires time.Time
+}
+
+func newFakeToken() fakeToken {
+	return fakeToken{
+		val:     "tok-" + time.Now().Format(time.RFC3339Nano),
+		created: time.Now(),
+		expires: time.Now().Add(time.Minute),
+	}
+}
+
+func (t fakeToken) String() string     { return t.val }
+func (t fakeToken) Created() time.Time { return t.created }
+func (t fakeToken) Expires() time.Time { return t.expires }
+func (t fakeToken) Validate() error    { return nil }
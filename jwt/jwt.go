@@ -0,0 +1,144 @@
+// Package jwt provides a tokensync.Token backed by a signed JWT and a
+// Client that mints them, so OAuth/OIDC-style service-account flows don't
+// need to write their own Token implementation.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v5"
+
+	tokensync "github.com/tempcke/tk"
+)
+
+// Token implements tokensync.Token over a compact JWS. Created/Expires
+// read the iat/exp claims; Validate re-verifies the signature and the
+// standard claims (exp/nbf/iss/aud) against the configuration it was
+// built with.
+type Token struct {
+	raw        string
+	claims     jwtlib.RegisteredClaims
+	keyFunc    jwtlib.Keyfunc
+	parserOpts []jwtlib.ParserOption
+}
+
+// Parse decodes raw without verifying its signature, so Created/Expires
+// and String are available immediately; call Validate to verify it.
+func Parse(raw string, keyFunc jwtlib.Keyfunc, opts ...jwtlib.ParserOption) (*Token, error) {
+	var claims jwtlib.RegisteredClaims
+	if _, _, err := jwtlib.NewParser(opts...).ParseUnverified(raw, &claims); err != nil {
+		return nil, err
+	}
+	return &Token{raw: raw, claims: claims, keyFunc: keyFunc, parserOpts: opts}, nil
+}
+
+func (t *Token) String() string { return t.raw }
+
+func (t *Token) Created() time.Time {
+	if t.claims.IssuedAt == nil {
+		return time.Time{}
+	}
+	return t.claims.IssuedAt.Time
+}
+
+func (t *Token) Expires() time.Time {
+	if t.claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return t.claims.ExpiresAt.Time
+}
+
+func (t *Token) Validate() error {
+	var claims jwtlib.RegisteredClaims
+	_, err := jwtlib.ParseWithClaims(t.raw, &claims, t.keyFunc, t.parserOpts...)
+	return err
+}
+
+// Client mints tokens by signing standard claims (iss, sub, iat, exp) with
+// a caller-supplied crypto.Signer. Only the standard library RSA, ECDSA
+// and Ed25519 private key types are supported, since golang-jwt signs
+// against those concrete types rather than the crypto.Signer interface.
+type Client struct {
+	signer        crypto.Signer
+	signingMethod jwtlib.SigningMethod
+	keyFunc       jwtlib.Keyfunc
+	parserOpts    []jwtlib.ParserOption
+
+	issuer   string
+	subject  string
+	audience []string
+	ttl      time.Duration
+}
+
+// Option configures a Client built with NewClient.
+type Option func(*Client)
+
+func WithIssuer(issuer string) Option   { return func(c *Client) { c.issuer = issuer } }
+func WithSubject(subject string) Option { return func(c *Client) { c.subject = subject } }
+func WithAudience(aud ...string) Option { return func(c *Client) { c.audience = aud } }
+func WithTTL(ttl time.Duration) Option  { return func(c *Client) { c.ttl = ttl } }
+func WithParserOptions(opts ...jwtlib.ParserOption) Option {
+	return func(c *Client) { c.parserOpts = opts }
+}
+
+// NewClient builds a tokensync.Client that mints JWTs signed with signer
+// using signingMethod, and validates minted/refreshed tokens with keyFunc
+// (typically returning signer's public key).
+func NewClient(signer crypto.Signer, signingMethod jwtlib.SigningMethod, keyFunc jwtlib.Keyfunc, opts ...Option) *Client {
+	c := &Client{
+		signer:        signer,
+		signingMethod: signingMethod,
+		keyFunc:       keyFunc,
+		ttl:           time.Hour,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewToken ignores key: one Client is already configured for a single
+// issuer/subject/audience, so every token it mints is for that one
+// tenant regardless of which key a multi-tenant TokenKeeper asks for.
+func (c *Client) NewToken(_ context.Context, _ string) (tokensync.Token, error) {
+	key, err := signingKey(c.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := jwtlib.RegisteredClaims{
+		Issuer:    c.issuer,
+		Subject:   c.subject,
+		Audience:  c.audience,
+		IssuedAt:  jwtlib.NewNumericDate(now),
+		ExpiresAt: jwtlib.NewNumericDate(now.Add(c.ttl)),
+	}
+
+	raw, err := jwtlib.NewWithClaims(c.signingMethod, claims).SignedString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{raw: raw, claims: claims, keyFunc: c.keyFunc, parserOpts: c.parserOpts}, nil
+}
+
+// RefreshToken simply re-mints, since a JWT can't be extended in place.
+func (c *Client) RefreshToken(ctx context.Context, key string, _ tokensync.Token) (tokensync.Token, error) {
+	return c.NewToken(ctx, key)
+}
+
+func signingKey(signer crypto.Signer) (interface{}, error) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("jwt: unsupported signer type %T", signer)
+	}
+}
@@ -0,0 +1,86 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tokensync "github.com/tempcke/tk"
+	tkjwt "github.com/tempcke/tk/jwt"
+)
+
+func newKeyPair(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return pub, priv
+}
+
+func keyFuncFor(pub ed25519.PublicKey) jwtlib.Keyfunc {
+	return func(_ *jwtlib.Token) (interface{}, error) { return pub, nil }
+}
+
+func TestClient(t *testing.T) {
+	pub, priv := newKeyPair(t)
+	ctx := context.Background()
+
+	t.Run("mints a valid token", func(t *testing.T) {
+		client := tkjwt.NewClient(priv, jwtlib.SigningMethodEdDSA, keyFuncFor(pub),
+			tkjwt.WithIssuer("tokensync"), tkjwt.WithSubject("svc-account"), tkjwt.WithTTL(time.Minute))
+
+		tok, err := client.NewToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+		assert.NoError(t, tok.Validate())
+		assert.WithinDuration(t, time.Now(), tok.Created(), time.Second)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), tok.Expires(), time.Second)
+	})
+
+	t.Run("refresh re-mints a valid token", func(t *testing.T) {
+		client := tkjwt.NewClient(priv, jwtlib.SigningMethodEdDSA, keyFuncFor(pub))
+
+		a, err := client.NewToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+		b, err := client.RefreshToken(ctx, tokensync.DefaultKey, a)
+		require.NoError(t, err)
+		assert.NoError(t, b.Validate())
+	})
+
+	t.Run("fails signature validation with the wrong key", func(t *testing.T) {
+		wrongPub, _ := newKeyPair(t)
+		client := tkjwt.NewClient(priv, jwtlib.SigningMethodEdDSA, keyFuncFor(pub))
+
+		tok, err := client.NewToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+
+		untrusted, err := tkjwt.Parse(tok.String(), keyFuncFor(wrongPub))
+		require.NoError(t, err)
+		assert.Error(t, untrusted.Validate())
+	})
+
+	t.Run("fails validation once expired", func(t *testing.T) {
+		client := tkjwt.NewClient(priv, jwtlib.SigningMethodEdDSA, keyFuncFor(pub), tkjwt.WithTTL(-time.Minute))
+
+		tok, err := client.NewToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+		assert.Error(t, tok.Validate())
+	})
+
+	t.Run("enforces configured audience", func(t *testing.T) {
+		client := tkjwt.NewClient(priv, jwtlib.SigningMethodEdDSA, keyFuncFor(pub), tkjwt.WithAudience("api-a"))
+
+		tok, err := client.NewToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+
+		strict, err := tkjwt.Parse(tok.String(), keyFuncFor(pub), jwtlib.WithAudience("api-b"))
+		require.NoError(t, err)
+		assert.Error(t, strict.Validate())
+	})
+}
+
+var _ tokensync.Token = (*tkjwt.Token)(nil)
+var _ tokensync.Client = (*tkjwt.Client)(nil)
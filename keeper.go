@@ -2,13 +2,16 @@ package tk
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
@@ -17,6 +20,11 @@ var (
 	ErrClientRefreshTokenFailed = errors.New("client.RefreshToken failed")
 )
 
+// DefaultKey identifies the token returned by Token when a caller doesn't
+// need more than one: TokenKeeper keeps a separate Token per key, but most
+// callers only ever manage a single one.
+const DefaultKey = "default"
+
 type Token interface {
 	String() string
 	Created() time.Time
@@ -24,33 +32,122 @@ type Token interface {
 	Validate() error
 }
 
+// Client mints and refreshes the token identified by key, so a single
+// Client can serve every named token a TokenKeeper manages (e.g. one
+// audience/scope per key) instead of needing one Client per key.
 type Client interface {
-	NewToken(ctx context.Context) (Token, error)
-	RefreshToken(ctx context.Context, t Token) (Token, error)
+	NewToken(ctx context.Context, key string) (Token, error)
+	RefreshToken(ctx context.Context, key string, t Token) (Token, error)
 }
 
+// Repo persists the token identified by key, and serializes concurrent
+// writers across pods via Lock/Unlock; a store backing more than one key
+// is expected to lock each key independently, not the whole store.
 type Repo interface {
-	GetToken(ctx context.Context) (Token, error)
-	StoreToken(ctx context.Context, token Token) error
-	Lock(ctx context.Context) error
-	Unlock(ctx context.Context) error
+	GetToken(ctx context.Context, key string) (Token, error)
+	StoreToken(ctx context.Context, key string, token Token) error
+	Lock(ctx context.Context, key string) error
+	Unlock(ctx context.Context, key string) error
+}
+
+// DefaultLeaseTTL is how long a lease granted by a LeasedRepo is trusted
+// before a TokenKeeper will attempt to steal it, used when WithLeaseTTL
+// is not called.
+const DefaultLeaseTTL = 30 * time.Second
+
+// DefaultRefreshSkew is how long before a token expires Start's background
+// goroutine attempts to refresh it, used when WithRefreshSkew is not called.
+const DefaultRefreshSkew = 30 * time.Second
+
+// Lease is a held, time-bounded lock returned by LeasedRepo.LockTTL. The
+// holder must call Renew before ttl elapses to keep it, and Release when
+// done; a lease that is never renewed is expected to expire on its own so
+// another holder may steal it.
+type Lease interface {
+	Renew(ctx context.Context) error
+	Release(ctx context.Context) error
+}
+
+// WatchableRepo is an optional capability a Repo may implement to push
+// token updates instead of requiring every waiting pod to poll behind the
+// lock. Watch should emit a Token each time StoreToken commits a new one
+// for key.
+type WatchableRepo interface {
+	Repo
+	Watch(ctx context.Context, key string) (<-chan Token, error)
+}
+
+// CASRepo is an optional capability a Repo may implement on top of an
+// optimistic-concurrency store (e.g. etcd) instead of an explicit
+// Lock/Unlock round trip. When a TokenKeeper's repo implements CASRepo,
+// it is used in place of Lock/Unlock to obtain the first token: the repo
+// itself decides, via a compare-and-swap, whether to mint through
+// newToken or hand back whichever token a concurrent winner already
+// committed, so the loser of a race never makes a redundant client call.
+type CASRepo interface {
+	Repo
+	GetOrCreate(ctx context.Context, key string, newToken func() (Token, error)) (Token, error)
+}
+
+// LeasedRepo is an optional capability a Repo may implement to bound how
+// long Lock may be held. If a TokenKeeper's repo implements LeasedRepo, it
+// heartbeats the returned lease while it mints a token instead of using
+// the unbounded Repo.Lock/Unlock; a repo that observes a lease held past
+// its ttl is expected to let another holder steal it via a compare-and-swap
+// on the lease identity, so a pod that dies mid-mint can't wedge the rest.
+type LeasedRepo interface {
+	Repo
+	LockTTL(ctx context.Context, key string, ttl time.Duration) (Lease, error)
 }
 
 type TokenKeeper struct {
-	ctx    context.Context
+	// baseCtx is the context every repo/client call made outside of Start's
+	// goroutine uses; baseCtxMu guards it because Start may reassign it
+	// (once Start is actually called) concurrently with a Token call
+	// already reading it.
+	baseCtx   context.Context
+	baseCtxMu sync.Mutex
+
 	client Client
-	token  Token
 	logger logrus.FieldLogger
-	lock   sync.Mutex
 	repo   Repo
+	sf     singleflight.Group
+
+	// tokens holds one Token per key; tokensMu guards the map itself, not
+	// the (possibly slow) work that produces a new value for it, so
+	// refreshing key A never blocks a reader of key B. The singleflight
+	// group above is also keyed by key for the same reason: concurrent
+	// refreshes of different keys never wait on each other.
+	tokens   map[string]Token
+	tokensMu sync.RWMutex
+
+	watched   map[string]bool
+	watchedMu sync.Mutex
+
+	refreshSkew         time.Duration
+	jitter              time.Duration
+	keepAliveCancel     context.CancelFunc
+	keepAliveDone       chan struct{}
+	keepAliveFailures   map[string]int
+	keepAliveFailuresMu sync.Mutex
+
+	leaseTTL time.Duration
+
+	claimsUnmarshaler ClaimsUnmarshaler
 }
 
 func NewTokenKeeper(client Client) *TokenKeeper {
 	log := logrus.New()
 	log.Out = ioutil.Discard
 	return &TokenKeeper{
-		client: client,
-		logger: log,
+		baseCtx:           context.Background(),
+		client:            client,
+		logger:            log,
+		leaseTTL:          DefaultLeaseTTL,
+		refreshSkew:       DefaultRefreshSkew,
+		tokens:            make(map[string]Token),
+		watched:           make(map[string]bool),
+		keepAliveFailures: make(map[string]int),
 	}
 }
 
@@ -64,91 +161,478 @@ func (k *TokenKeeper) WithRepo(repo Repo) *TokenKeeper {
 	return k
 }
 
-func (k *TokenKeeper) Token() Token {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-	if k.token == nil {
-		t, err := k.getToken()
-		if t == nil {
+// WithClaimsUnmarshaler overrides how Claims decodes a MetadataToken's raw
+// metadata. Defaults to json.Unmarshal.
+func (k *TokenKeeper) WithClaimsUnmarshaler(u ClaimsUnmarshaler) *TokenKeeper {
+	k.claimsUnmarshaler = u
+	return k
+}
+
+// ensureWatch subscribes to out-of-band updates for key the first time
+// Token(key) is called for it, so a token posted by whichever pod won the
+// refresh lands in k.tokens immediately instead of this pod waiting for
+// its next lock/poll cycle to notice it. A no-op once key is already
+// watched, or if the repo doesn't implement WatchableRepo.
+//
+// A watch established by a Token call made before Start binds to
+// context.Background() (ctx()'s default) rather than whatever ctx Start is
+// later given, so Stop won't tear it down; callers relying on Stop to
+// release watch resources should call Start before the first Token.
+func (k *TokenKeeper) ensureWatch(key string) {
+	wr, ok := k.repo.(WatchableRepo)
+	if !ok {
+		return
+	}
+
+	k.watchedMu.Lock()
+	if k.watched[key] {
+		k.watchedMu.Unlock()
+		return
+	}
+	k.watched[key] = true
+	k.watchedMu.Unlock()
+
+	events, err := wr.Watch(k.ctx(), key)
+	if err != nil {
+		k.logError(err, "failed to watch repo for token updates")
+		return
+	}
+
+	go func() {
+		for tok := range events {
+			if k.validateToken(tok) != nil {
+				continue
+			}
+			k.setToken(key, tok)
+		}
+	}()
+}
+
+// WithLeaseTTL sets how long a lease acquired from a LeasedRepo is trusted
+// before it may be stolen by another holder. It has no effect unless the
+// repo passed to WithRepo also implements LeasedRepo.
+func (k *TokenKeeper) WithLeaseTTL(ttl time.Duration) *TokenKeeper {
+	k.leaseTTL = ttl
+	return k
+}
+
+// WithRefreshSkew overrides how long before a token expires Start's
+// background goroutine attempts to refresh it. Defaults to
+// DefaultRefreshSkew.
+func (k *TokenKeeper) WithRefreshSkew(skew time.Duration) *TokenKeeper {
+	k.refreshSkew = skew
+	return k
+}
+
+// WithJitter makes Start's background goroutine wake a random amount in
+// [0, jitter) earlier than refreshSkew each cycle, so pods sharing a repo
+// don't all attempt a refresh at the same instant; combined with the repo
+// lock, one pod wins and the rest pick up the new token via GetToken.
+func (k *TokenKeeper) WithJitter(jitter time.Duration) *TokenKeeper {
+	k.jitter = jitter
+	return k
+}
+
+// Start launches a goroutine which refreshes every key this keeper has
+// served at least once before it expires, instead of waiting for a caller
+// of Token to observe the expiration, so steady-state callers never block
+// on client/repo I/O. It also replaces the context used for every
+// repo/client call the keeper makes from then on (context.Background() by
+// default) with ctx, so its cancellation stops those calls too. Call Stop
+// to cancel the goroutine. Start is a no-op if already running.
+func (k *TokenKeeper) Start(ctx context.Context) {
+	if k.keepAliveCancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	k.baseCtxMu.Lock()
+	k.baseCtx = ctx
+	k.baseCtxMu.Unlock()
+	k.keepAliveCancel = cancel
+	k.keepAliveDone = make(chan struct{})
+	go k.keepAliveLoop()
+}
+
+// ctx returns the context every repo/client call should currently use:
+// whatever Start last set it to, or context.Background() if Start has
+// never been called.
+func (k *TokenKeeper) ctx() context.Context {
+	k.baseCtxMu.Lock()
+	defer k.baseCtxMu.Unlock()
+	return k.baseCtx
+}
+
+// Stop cancels the goroutine started by Start and waits for it to exit.
+func (k *TokenKeeper) Stop() {
+	if k.keepAliveCancel == nil {
+		return
+	}
+	k.keepAliveCancel()
+	<-k.keepAliveDone
+	k.keepAliveCancel = nil
+}
+
+// backoffBase is the first retry delay in the exponential backoff
+// keepAliveLoop applies after a failed refresh: 1s, 2s, 4s, ... capped at
+// the token's remaining validity window.
+const backoffBase = time.Second
+
+// noTrackedKeysPollInterval is how often keepAliveLoop checks back when it
+// isn't tracking any keys yet, e.g. right after Start but before the first
+// Token(key) call registers one.
+const noTrackedKeysPollInterval = time.Second
+
+func (k *TokenKeeper) keepAliveLoop() {
+	defer close(k.keepAliveDone)
+	for {
+		key, delay := k.nextKeepAlive()
+
+		select {
+		case <-time.After(delay):
+		case <-k.ctx().Done():
+			return
+		}
+
+		if key == "" {
+			continue
+		}
+
+		if err := k.keepAliveRefresh(key); err != nil {
+			k.keepAliveFailuresMu.Lock()
+			k.keepAliveFailures[key]++
+			k.keepAliveFailuresMu.Unlock()
+			continue
+		}
+		k.keepAliveFailuresMu.Lock()
+		delete(k.keepAliveFailures, key)
+		k.keepAliveFailuresMu.Unlock()
+	}
+}
+
+// nextKeepAlive finds whichever key this keeper has served is next due for
+// a proactive refresh, and how long until then, so one background loop
+// keeps every named token fresh instead of needing one goroutine per key.
+func (k *TokenKeeper) nextKeepAlive() (string, time.Duration) {
+	k.tokensMu.RLock()
+	tokens := make(map[string]Token, len(k.tokens))
+	for key, tok := range k.tokens {
+		tokens[key] = tok
+	}
+	k.tokensMu.RUnlock()
+
+	if len(tokens) == 0 {
+		return "", noTrackedKeysPollInterval
+	}
+
+	var (
+		bestKey   string
+		bestDelay time.Duration
+		found     bool
+	)
+	for key, tok := range tokens {
+		delay := k.keepAliveDelay(tok)
+
+		k.keepAliveFailuresMu.Lock()
+		failures := k.keepAliveFailures[key]
+		k.keepAliveFailuresMu.Unlock()
+		if failures > 0 {
+			delay = backoffBase << uint(failures-1)
+			if remaining := time.Until(tok.Expires()); remaining > 0 && delay > remaining {
+				delay = remaining
+			}
+		}
+
+		if !found || delay < bestDelay {
+			found, bestKey, bestDelay = true, key, delay
+		}
+	}
+	return bestKey, bestDelay
+}
+
+// keepAliveDelay computes how long to wait before the next proactive
+// refresh: Expires - refreshSkew - rand[0, jitter).
+func (k *TokenKeeper) keepAliveDelay(tok Token) time.Duration {
+	jitter := time.Duration(0)
+	if k.jitter > 0 {
+		jitter = time.Duration(rand.Int63n(int64(k.jitter)))
+	}
+	d := tok.Expires().Sub(time.Now()) - k.refreshSkew - jitter
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// lockRepo acquires the repo lock for key, preferring a LeasedRepo's
+// bounded lease (heartbeating it for as long as it's held) when the repo
+// supports one, and returns a func that releases whichever kind was
+// acquired. A non-nil error means no lock was acquired at all (e.g. Lock
+// returned ErrLockTimeout): the caller does not hold the repo lock and
+// must not proceed as though it does.
+func (k *TokenKeeper) lockRepo(ctx context.Context, key string) (func(), error) {
+	lr, ok := k.repo.(LeasedRepo)
+	if !ok {
+		if err := k.repo.Lock(ctx, key); err != nil {
+			return func() {}, err
+		}
+		return func() { _ = k.repo.Unlock(ctx, key) }, nil
+	}
+
+	lease, err := lr.LockTTL(ctx, key, k.leaseTTL)
+	if err != nil {
+		k.logError(err, "failed to acquire lease")
+		return func() {}, err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(k.leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := lease.Renew(ctx); err != nil {
+					k.logError(err, "failed to renew lease")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+		if err := lease.Release(ctx); err != nil {
+			k.logError(err, "failed to release lease")
+		}
+	}, nil
+}
+
+// refreshToken does the actual work of replacing cur with a fresh token
+// for key: a double-checked read of the repo after acquiring its lock
+// (another pod, or another goroutine that already ran through this same
+// singleflight call, may have beaten us to it and published a newer token
+// already), and only then a call to client.RefreshToken. The repo token
+// only counts as someone else's work if it's actually different from cur;
+// otherwise it's just the same token we already have, and this call needs
+// to do the refreshing.
+func (k *TokenKeeper) refreshToken(key string, cur Token) (Token, error) {
+	if k.repo != nil {
+		unlock, err := k.lockRepo(k.ctx(), key)
+		if err != nil {
+			k.logError(err, "failed to lock repo for refresh")
+			// couldn't confirm whether another pod already refreshed: serve
+			// whatever we already have rather than stampeding the client
+			// alongside every other pod whose lock attempt also failed
+			if cur != nil {
+				return cur, nil
+			}
+			return nil, err
+		}
+		defer unlock()
+
+		if t, err := k.repo.GetToken(k.ctx(), key); err == nil && k.validateToken(t) == nil &&
+			(cur == nil || t.String() != cur.String()) {
+			k.setToken(key, t)
+			return t, nil
+		}
+	}
+
+	tok, err := k.client.RefreshToken(k.ctx(), key, cur)
+	if err != nil {
+		return nil, err
+	}
+
+	k.storeToken(key, tok)
+	return tok, nil
+}
+
+func (k *TokenKeeper) keepAliveRefresh(key string) error {
+	cur := k.cachedToken(key)
+
+	v, err, _ := k.sf.Do(key, func() (interface{}, error) {
+		return k.refreshToken(key, cur)
+	})
+	if err != nil {
+		k.logError(err, ErrClientRefreshTokenFailed.Error())
+		return err
+	}
+
+	// refreshToken returns cur as-is, with no error, when it couldn't
+	// confirm the repo lock and fell back to serving whatever's cached: if
+	// that still isn't valid, this round didn't actually keep the token
+	// alive, so it must count as a failure or nextKeepAlive would compute
+	// its delay from an already-expired token's keepAliveDelay (0) and
+	// busy-loop against the repo lock with no backoff.
+	if tok, _ := v.(Token); k.validateToken(tok) != nil {
+		return errors.New("keep-alive refresh did not yield a valid token")
+	}
+	return nil
+}
+
+// Token returns the current, valid token for key, minting or refreshing
+// one as needed. Each key is tracked independently: a slow refresh of one
+// key never blocks a reader of another.
+//
+// If a shared repo's lock can't be confirmed (e.g. ErrLockTimeout) while an
+// existing token needs refreshing, Token serves that token as-is rather
+// than stampeding the client alongside every other pod in the same spot:
+// callers that must reject a stale token should check Validate()/Expires()
+// themselves.
+func (k *TokenKeeper) Token(key string) Token {
+	k.ensureWatch(key)
+
+	tok := k.cachedToken(key)
+
+	if tok == nil {
+		v, err, _ := k.sf.Do(key, func() (interface{}, error) {
+			if t := k.cachedToken(key); t != nil {
+				return t, nil
+			}
+			return k.getToken(key)
+		})
+		if err != nil {
 			k.logError(err, ErrClientNewTokenFailed.Error())
 			err = fmt.Errorf("%w: %s", ErrClientNewTokenFailed, err)
 			return newInvalidToken(err)
 		}
-		k.token = t
+		tok = v.(Token)
+		k.setToken(key, tok)
 	}
-	if err := k.validateToken(k.token); err != nil {
-		k.logger.WithField("token", k.token).
+
+	if err := k.validateToken(tok); err != nil {
+		k.logger.WithField("token", tok).
 			WithError(err).Warn("token invalid")
-		tok, err := k.client.RefreshToken(k.ctx, k.token)
+
+		v, err, _ := k.sf.Do(key, func() (interface{}, error) {
+			cur := k.cachedToken(key)
+			if k.validateToken(cur) == nil {
+				return cur, nil
+			}
+			return k.refreshToken(key, cur)
+		})
 		if err != nil {
 			k.logError(err, ErrClientRefreshTokenFailed.Error())
 			err = fmt.Errorf("%w: %s", ErrClientRefreshTokenFailed, err)
 			return newInvalidToken(err)
 		}
-		k.storeToken(tok)
+		tok = v.(Token)
+	}
+	return tok
+}
 
+// Claims decodes key's current token's metadata into target, for callers
+// whose Client/Repo mint MetadataToken (e.g. a StoredToken carrying JWT
+// claims or other out-of-band metadata). Returns an error if the token is
+// invalid or doesn't implement MetadataToken.
+func (k *TokenKeeper) Claims(key string, target interface{}) error {
+	tok := k.Token(key)
+	if err := k.validateToken(tok); err != nil {
+		return err
+	}
+
+	mt, ok := tok.(MetadataToken)
+	if !ok {
+		return fmt.Errorf("token for key %q does not carry metadata", key)
+	}
+
+	unmarshal := k.claimsUnmarshaler
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
 	}
-	return k.token
+	return unmarshal(mt.TokenMetadata(), target)
 }
 
-// getToken is called only when k.token is nil
-func (k *TokenKeeper) getToken() (Token, error) {
-	if t := k.tokenFromRepo(); t != nil {
+// getToken is called only when key has no cached token yet.
+func (k *TokenKeeper) getToken(key string) (Token, error) {
+	// a CASRepo resolves get-or-create itself via compare-and-swap, so it
+	// skips the Lock/Unlock round trip tokenFromRepo would otherwise take
+	// on every cold start
+	if cr, ok := k.repo.(CASRepo); ok {
+		return cr.GetOrCreate(k.ctx(), key, func() (Token, error) { return k.client.NewToken(k.ctx(), key) })
+	}
+
+	if t := k.tokenFromRepo(key); t != nil {
 		return t, nil
 	}
 
 	if k.repo != nil {
 		// multi pod lock to prevent each pod from calling client.NewToken()
-		_ = k.repo.Lock(k.ctx)
-		defer k.repo.Unlock(k.ctx)
+		unlock, err := k.lockRepo(k.ctx(), key)
+		if err != nil {
+			// couldn't confirm whether another pod is already minting one:
+			// bail out instead of stampeding the client alongside every
+			// other pod whose lock attempt also failed
+			return nil, err
+		}
+		defer unlock()
 
 		// did another thread in this runtime already update the token?
-		if k.token != nil {
-			return k.token, nil
+		// (e.g. a watch push landed while we waited for the lock)
+		if cur := k.cachedToken(key); cur != nil {
+			return cur, nil
 		}
 
 		// did another k8s pod already update the token in the repo?
-		if t, err := k.repo.GetToken(k.ctx); err == nil {
+		if t, err := k.repo.GetToken(k.ctx(), key); err == nil {
 			return t, nil
 		}
 	}
 
-	return k.tokenFromClient()
+	return k.tokenFromClient(key)
 }
 
-func (k *TokenKeeper) storeToken(t Token) {
+func (k *TokenKeeper) storeToken(key string, t Token) {
 	if k.repo != nil {
-		if err := k.repo.StoreToken(k.ctx, t); err != nil {
+		if err := k.repo.StoreToken(k.ctx(), key, t); err != nil {
 			k.logError(err, "failed to store token in repo")
 		}
 	}
 
-	k.token = t
+	k.setToken(key, t)
+}
+
+func (k *TokenKeeper) setToken(key string, t Token) {
+	k.tokensMu.Lock()
+	k.tokens[key] = t
+	k.tokensMu.Unlock()
+}
+
+func (k *TokenKeeper) cachedToken(key string) Token {
+	k.tokensMu.RLock()
+	defer k.tokensMu.RUnlock()
+	return k.tokens[key]
 }
 
-func (k *TokenKeeper) tokenFromRepo() Token {
+func (k *TokenKeeper) tokenFromRepo(key string) Token {
 	if k.repo == nil {
 		return nil
 	}
-	_ = k.repo.Lock(k.ctx)
-	defer k.repo.Unlock(k.ctx)
-	t, err := k.repo.GetToken(k.ctx)
+	unlock, err := k.lockRepo(k.ctx(), key)
+	if err != nil {
+		return nil
+	}
+	defer unlock()
+	t, err := k.repo.GetToken(k.ctx(), key)
 	if err != nil {
 		return nil
 	}
 	return t
 }
 
-func (k *TokenKeeper) tokenFromClient() (Token, error) {
+func (k *TokenKeeper) tokenFromClient(key string) (Token, error) {
 	if k.client == nil {
 		return nil, ErrClientIsNil
 	}
-	t, err := k.client.NewToken(k.ctx)
+	t, err := k.client.NewToken(k.ctx(), key)
 	if err != nil {
 		return nil, err
 	}
 	if t.Validate() == nil {
-		k.storeToken(t)
+		k.storeToken(key, t)
 	}
 	return t, nil
 }
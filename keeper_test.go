@@ -2,8 +2,10 @@ package tk_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -21,32 +23,45 @@ func TestTokenKeeper(t *testing.T) {
 
 	t.Run("should return same token each time", func(t *testing.T) {
 		keeper := tokensync.NewTokenKeeper(client)
-		tok := keeper.Token()
+		tok := keeper.Token(tokensync.DefaultKey)
 		assert.NotEmpty(t, tok)
 
-		assert.Equal(t, tok, keeper.Token())
+		assert.Equal(t, tok, keeper.Token(tokensync.DefaultKey))
 	})
 
 	t.Run("should get new token when expired", func(t *testing.T) {
 		keeper := tokensync.NewTokenKeeper(client)
-		tokA := keeper.Token()
+		tokA := keeper.Token(tokensync.DefaultKey)
 		a := tokA.String()
 		assert.NoError(t, tokA.Validate())
 		client.expireToken()
-		tokB := keeper.Token()
+		tokB := keeper.Token(tokensync.DefaultKey)
 		assert.NotEqual(t, a, tokB.String())
 		assert.NoError(t, tokB.Validate())
 	})
 
 	t.Run("should refresh token when token not valid", func(t *testing.T) {
 		keeper := tokensync.NewTokenKeeper(client)
-		tokA := keeper.Token() // valid token
+		tokA := keeper.Token(tokensync.DefaultKey) // valid token
 		client.curToken.err = errors.New("anything " + uuid.NewString())
 
-		tokB := keeper.Token()
+		tokB := keeper.Token(tokensync.DefaultKey)
 		assert.NotEqual(t, tokA, tokB)
 		assert.NoError(t, tokB.Validate())
 	})
+
+	t.Run("tracks a separate token per key", func(t *testing.T) {
+		keeper := tokensync.NewTokenKeeper(client)
+
+		tokA := keeper.Token("tenant-a")
+		tokB := keeper.Token("tenant-b")
+		require.NotEqual(t, tokA.String(), tokB.String())
+
+		// re-fetching either key returns its own cached token, not the
+		// other key's
+		assert.Equal(t, tokA.String(), keeper.Token("tenant-a").String())
+		assert.Equal(t, tokB.String(), keeper.Token("tenant-b").String())
+	})
 }
 
 func TestTokenKeeper_concurrent(t *testing.T) {
@@ -71,7 +86,7 @@ func TestTokenKeeper_concurrent(t *testing.T) {
 			wg.Add(1)
 			go func(i int) {
 				defer wg.Done()
-				tokens[i] = keeper.Token()
+				tokens[i] = keeper.Token(tokensync.DefaultKey)
 			}(i) // pass i in or else bad things happen :)
 		}
 		wg.Wait()
@@ -80,7 +95,7 @@ func TestTokenKeeper_concurrent(t *testing.T) {
 		}
 
 		// one for first token
-		require.Equal(t, 1, client.reqCount)
+		require.Equal(t, 1, client.reqCount())
 	})
 
 	t.Run("refresh tokens", func(t *testing.T) {
@@ -88,7 +103,7 @@ func TestTokenKeeper_concurrent(t *testing.T) {
 		keeper := tokensync.NewTokenKeeper(client)
 
 		// get first token, expire it, then slow down the client
-		firstToken := keeper.Token()
+		firstToken := keeper.Token(tokensync.DefaultKey)
 		require.NoError(t, firstToken.Validate())
 		client.expireToken()
 		client.lag = lag // slow it down
@@ -99,7 +114,7 @@ func TestTokenKeeper_concurrent(t *testing.T) {
 			wg.Add(1)
 			go func(i int) {
 				defer wg.Done()
-				tokens[i] = keeper.Token()
+				tokens[i] = keeper.Token(tokensync.DefaultKey)
 			}(i) // pass i in or else bad things happen :)
 		}
 		wg.Wait()
@@ -108,7 +123,71 @@ func TestTokenKeeper_concurrent(t *testing.T) {
 		}
 
 		// one for first token, one for refresh token
-		require.Equal(t, 2, client.reqCount)
+		require.Equal(t, 2, client.reqCount())
+	})
+
+	t.Run("singleflight coalesces concurrent refreshes into one upstream call", func(t *testing.T) {
+		// this pins down the same guarantee as "refresh tokens" above, but
+		// isolates it: N goroutines racing on an already-expired token
+		// should share exactly one client.RefreshToken call via the
+		// keeper's singleflight group, not one per goroutine.
+		client := (&fakeClient{}).withLag(lag)
+		keeper := tokensync.NewTokenKeeper(client)
+
+		firstToken := keeper.Token(tokensync.DefaultKey)
+		require.NoError(t, firstToken.Validate())
+		client.expireToken()
+		client.resetReqCount() // only count calls made by the race below
+
+		var wg sync.WaitGroup
+		for i := 0; i < numCalls; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				keeper.Token(tokensync.DefaultKey)
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, 1, client.reqCount())
+	})
+
+	t.Run("refreshing one key does not block a read of another", func(t *testing.T) {
+		// a slow refresh of "tenant-a" (expired, heavily lagging client)
+		// must not make a concurrent Token("tenant-b") wait on it: each key
+		// is coalesced by its own singleflight key, and tenant-b's cached
+		// token is still valid so it never touches the client at all.
+		var (
+			refreshLag = 300 * time.Millisecond
+			readBudget = 100 * time.Millisecond // « refreshLag
+
+			client = &fakeClient{}
+			keeper = tokensync.NewTokenKeeper(client)
+		)
+
+		tokA := keeper.Token("tenant-a")
+		require.NoError(t, tokA.Validate())
+		tokB := keeper.Token("tenant-b")
+		require.NoError(t, tokB.Validate())
+		tokA.(*fakeToken).expireToken() // only tenant-a's token; tokB stays cached and valid
+		client.lag = refreshLag
+
+		refreshDone := make(chan struct{})
+		go func() {
+			defer close(refreshDone)
+			keeper.Token("tenant-a") // slow: triggers a laggy refresh
+		}()
+
+		readDone := make(chan tokensync.Token, 1)
+		go func() { readDone <- keeper.Token("tenant-b") }()
+
+		select {
+		case got := <-readDone:
+			assert.Equal(t, tokB.String(), got.String())
+		case <-time.After(readBudget):
+			t.Fatal("Token(\"tenant-b\") waited on tenant-a's in-flight refresh")
+		}
+		<-refreshDone
 	})
 }
 
@@ -123,12 +202,12 @@ func TestTokenKeeper_SharedToken(t *testing.T) {
 		// it should check the repo for a valid token
 
 		repo := &fakeRepo{}
-		_ = repo.StoreToken(ctx, newFakeToken())
+		_ = repo.StoreToken(ctx, tokensync.DefaultKey, newFakeToken())
 
 		client := &fakeClient{}
 		keeper := tokensync.NewTokenKeeper(client).WithRepo(repo)
-		assert.Equal(t, repo.token().String(), keeper.Token().String())
-		assert.Equal(t, 0, client.reqCount)
+		assert.Equal(t, repo.token().String(), keeper.Token(tokensync.DefaultKey).String())
+		assert.Equal(t, 0, client.reqCount())
 	})
 
 	t.Run("keeper stores new tokens into repo", func(t *testing.T) {
@@ -137,7 +216,7 @@ func TestTokenKeeper_SharedToken(t *testing.T) {
 			client = new(fakeClient)
 			keeper = tokensync.NewTokenKeeper(client).WithRepo(repo)
 		)
-		tok := keeper.Token() // new token from client
+		tok := keeper.Token(tokensync.DefaultKey) // new token from client
 		require.NotNil(t, tok)
 		require.NotNil(t, repo.token)
 		assert.Equal(t, tok.String(), repo.token().String())
@@ -150,12 +229,12 @@ func TestTokenKeeper_SharedToken(t *testing.T) {
 		origRepoToken := newFakeToken()
 		origRepoToken.expireToken()
 		repo := &fakeRepo{}
-		_ = repo.StoreToken(ctx, origRepoToken)
+		_ = repo.StoreToken(ctx, tokensync.DefaultKey, origRepoToken)
 
 		client := &fakeClient{}
 		keeper := tokensync.NewTokenKeeper(client).WithRepo(repo)
 
-		fetchedToken := keeper.Token()
+		fetchedToken := keeper.Token(tokensync.DefaultKey)
 
 		// assert we didn't get the expired token
 		assert.NotEqual(t, origRepoToken.String(), fetchedToken.String())
@@ -182,29 +261,29 @@ func TestTokenKeeper_SharedToken(t *testing.T) {
 		)
 
 		// lock the repo as though another process is updating the token
-		repo.Lock()
+		repo.Lock(ctx, tokensync.DefaultKey)
 
 		keeper := tokensync.NewTokenKeeper(client).WithRepo(repo)
 
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			fetchedToken = keeper.Token()
+			fetchedToken = keeper.Token(tokensync.DefaultKey)
 		}()
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			fetchedToken = keeper.Token()
+			fetchedToken = keeper.Token(tokensync.DefaultKey)
 		}()
 
 		// store the token in repo with lag after the keeper has requested it
-		require.NoError(t, repo.StoreToken(ctx, token))
+		require.NoError(t, repo.StoreToken(ctx, tokensync.DefaultKey, token))
 		// unlock the repo, this should now allow the keeper.Token() call to get this token
-		repo.Unlock()
+		repo.Unlock(ctx, tokensync.DefaultKey)
 		wg.Wait()
 
 		// assert token not fetched from client and that the fetchedToken is correct
-		require.Equal(t, 0, client.reqCount)
+		require.Equal(t, 0, client.reqCount())
 		require.Equal(t, token.String(), fetchedToken.String())
 
 		// assert repo token was not changed
@@ -236,22 +315,22 @@ func TestTokenKeeper_SharedToken(t *testing.T) {
 		wg.Add(2)
 		go func() {
 			defer wg.Done()
-			_ = keeper1.Token()
+			_ = keeper1.Token(tokensync.DefaultKey)
 		}()
 		go func() {
 			defer wg.Done()
-			_ = keeper2.Token()
+			_ = keeper2.Token(tokensync.DefaultKey)
 		}()
 		wg.Wait()
 
 		// both keepers should have the same token
-		require.Equal(t, keeper1.Token().String(), keeper2.Token().String())
+		require.Equal(t, keeper1.Token(tokensync.DefaultKey).String(), keeper2.Token(tokensync.DefaultKey).String())
 
 		// repo token and keeper token should match
-		require.Equal(t, keeper1.Token().String(), repo1.token().String())
+		require.Equal(t, keeper1.Token(tokensync.DefaultKey).String(), repo1.token().String())
 
 		// only 1 request for a token should be made total
-		assert.Equal(t, 1, client1.reqCount+client2.reqCount)
+		assert.Equal(t, 1, client1.reqCount()+client2.reqCount())
 	})
 }
 
@@ -291,7 +370,7 @@ func TestTokenKeeper_multiProcess(t *testing.T) {
 		wg.Add(1)
 		go func(i int, p *pod) {
 			defer wg.Done()
-			tokens[i] = p.keeper.Token()
+			tokens[i] = p.keeper.Token(tokensync.DefaultKey)
 		}(i, p)
 	}
 	wg.Wait()
@@ -304,7 +383,7 @@ func TestTokenKeeper_multiProcess(t *testing.T) {
 	// the sum of all client calls from all pods should be 1
 	callCount := 0
 	for _, p := range pods {
-		callCount += p.client.reqCount
+		callCount += p.client.reqCount()
 	}
 	require.Equal(t, 1, callCount)
 }
@@ -312,35 +391,351 @@ func TestTokenKeeper_multiProcess(t *testing.T) {
 func TestTokenKeeper_errors(t *testing.T) {
 	t.Run("cant get token from client", func(t *testing.T) {
 		client := &fakeClient{}
-		client.err = errors.New("unknown error " + uuid.NewString())
+		client.setErr(errors.New("unknown error " + uuid.NewString()))
 
 		keeper := tokensync.NewTokenKeeper(client)
-		tok := keeper.Token()
+		tok := keeper.Token(tokensync.DefaultKey)
 		assert.ErrorIs(t, tok.Validate(), tokensync.ErrClientNewTokenFailed)
-		assert.ErrorContains(t, tok.Validate(), client.err.Error())
+		assert.ErrorContains(t, tok.Validate(), client.err().Error())
 	})
 	t.Run("cant refresh token", func(t *testing.T) {
 		client := &fakeClient{}
 		keeper := tokensync.NewTokenKeeper(client)
-		_ = keeper.Token() // valid token
+		_ = keeper.Token(tokensync.DefaultKey) // valid token
 
 		// expire current token
 		client.expireToken()
 
 		// force client to return error on RefreshToken call
-		client.err = errors.New("unknown error " + uuid.NewString())
+		client.setErr(errors.New("unknown error " + uuid.NewString()))
 
-		tokB := keeper.Token()
+		tokB := keeper.Token(tokensync.DefaultKey)
 		assert.ErrorIs(t, tokB.Validate(), tokensync.ErrClientRefreshTokenFailed)
-		assert.ErrorContains(t, tokB.Validate(), client.err.Error())
+		assert.ErrorContains(t, tokB.Validate(), client.err().Error())
+	})
+}
+
+func TestTokenKeeper_LockFailure(t *testing.T) {
+	t.Run("serves the stale cached token instead of refreshing unprotected when the repo lock fails", func(t *testing.T) {
+		var (
+			client = &fakeClient{}
+			repo   = new(fakeRepo)
+			keeper = tokensync.NewTokenKeeper(client).WithRepo(repo)
+		)
+
+		first := keeper.Token(tokensync.DefaultKey)
+		require.NoError(t, first.Validate())
+
+		// another pod holds the lock (or it timed out): simulate by making
+		// every Lock call fail, then expire the cached token so the next
+		// call needs a refresh
+		repo.withLockErr(tokensync.ErrLockTimeout)
+		client.expireToken()
+
+		second := keeper.Token(tokensync.DefaultKey)
+		assert.Equal(t, first.String(), second.String(),
+			"should serve the already-cached token rather than race every other pod to refresh it")
+		assert.Equal(t, 0, client.refreshAttempts(),
+			"should not call the client while unable to confirm no other pod is already refreshing")
+	})
+
+	t.Run("bails out with an error when there is no cached token to fall back on", func(t *testing.T) {
+		var (
+			client = &fakeClient{}
+			repo   = new(fakeRepo).withLockErr(tokensync.ErrLockTimeout)
+			keeper = tokensync.NewTokenKeeper(client).WithRepo(repo)
+		)
+
+		tok := keeper.Token(tokensync.DefaultKey)
+		assert.ErrorIs(t, tok.Validate(), tokensync.ErrClientNewTokenFailed)
+		assert.ErrorContains(t, tok.Validate(), tokensync.ErrLockTimeout.Error())
+		assert.Equal(t, 0, client.reqCount(),
+			"should not mint a token via the client while unable to confirm no other pod is already minting one")
+	})
+}
+
+func TestTokenKeeper_KeepAlive(t *testing.T) {
+	t.Run("refreshes the token before it expires", func(t *testing.T) {
+		client := &fakeClient{}
+		keeper := tokensync.NewTokenKeeper(client).WithRefreshSkew(58 * time.Second)
+		keeper.Start(ctx)
+		defer keeper.Stop()
+
+		first := keeper.Token(tokensync.DefaultKey)
+		require.NoError(t, first.Validate())
+
+		require.Eventually(t, func() bool {
+			return client.reqCount() >= 2
+		}, 3*time.Second, time.Millisecond, "keep-alive should refresh without a caller ever seeing the token expire")
+
+		assert.NotEqual(t, first.String(), keeper.Token(tokensync.DefaultKey).String())
+	})
+
+	t.Run("only one pod refreshes when a repo is shared", func(t *testing.T) {
+		var (
+			dataStore = new(storage)
+
+			client1 = new(fakeClient)
+			client2 = new(fakeClient)
+
+			repo1 = new(fakeRepo).withStorage(dataStore)
+			repo2 = new(fakeRepo).withStorage(dataStore)
+
+			keeper1 = tokensync.NewTokenKeeper(client1).WithRepo(repo1).WithRefreshSkew(58 * time.Second)
+			keeper2 = tokensync.NewTokenKeeper(client2).WithRepo(repo2).WithRefreshSkew(58 * time.Second)
+		)
+
+		_ = keeper1.Token(tokensync.DefaultKey)
+		keeper1.Start(ctx)
+		keeper2.Start(ctx)
+
+		require.Eventually(t, func() bool {
+			return client1.reqCount()+client2.reqCount() >= 2
+		}, 3*time.Second, time.Millisecond)
+
+		// stop both loops as soon as the refresh lands, then confirm only
+		// one pod ever actually called the client a second time
+		keeper1.Stop()
+		keeper2.Stop()
+		assert.Equal(t, 2, client1.reqCount()+client2.reqCount())
+	})
+}
+
+func TestTokenKeeper_KeepAlive_Backoff(t *testing.T) {
+	t.Run("retries a failed refresh sooner than the next scheduled skew", func(t *testing.T) {
+		client := &fakeClient{}
+		keeper := tokensync.NewTokenKeeper(client).WithRefreshSkew(59 * time.Second)
+
+		first := keeper.Token(tokensync.DefaultKey)
+		require.NoError(t, first.Validate())
+
+		client.setErr(errors.New("upstream down " + uuid.NewString()))
+		keeper.Start(ctx)
+		defer keeper.Stop()
+
+		// the background loop should retry well before the 59s skew would
+		// normally fire again, since it's backing off from a failure
+		require.Eventually(t, func() bool {
+			return client.refreshAttempts() >= 2
+		}, 4*time.Second, 10*time.Millisecond, "a failed refresh should be retried via exponential backoff")
+
+		client.setErr(nil)
+		require.Eventually(t, func() bool {
+			return client.reqCount() >= 2
+		}, 4*time.Second, 10*time.Millisecond, "keeper should recover once the client starts succeeding again")
+	})
+
+	t.Run("backs off rather than busy-looping when the repo lock keeps failing", func(t *testing.T) {
+		var (
+			client = &fakeClient{}
+			repo   = new(fakeRepo)
+			keeper = tokensync.NewTokenKeeper(client).WithRepo(repo).WithRefreshSkew(58 * time.Second)
+		)
+
+		first := keeper.Token(tokensync.DefaultKey)
+		require.NoError(t, first.Validate())
+
+		// the cached token can no longer be confirmed or refreshed: every
+		// lock attempt fails, and it's already expired
+		repo.withLockErr(tokensync.ErrLockTimeout)
+		client.expireToken()
+		baseline := repo.lockAttempts()
+
+		keeper.Start(ctx)
+		defer keeper.Stop()
+
+		require.Eventually(t, func() bool {
+			return repo.lockAttempts() > baseline
+		}, time.Second, time.Millisecond, "keep-alive should at least try the lock once")
+
+		// give the loop a window it would have filled with many more
+		// attempts had it kept resetting its backoff to zero on every
+		// still-invalid result instead of treating it as a failure
+		time.Sleep(200 * time.Millisecond)
+		assert.LessOrEqual(t, repo.lockAttempts()-baseline, int32(2),
+			"a still-invalid result from a failed lock should back off, not busy-loop")
 	})
 }
 
 func TestTokenKeeper_fallback(t *testing.T) {
 	// test lock TTL, what happens if a process locks the repo and then dies?
 	// the keeper should be able to realize the lock is held for to long and take over
+	t.Run("a dead pod's lease is stolen by a live one", func(t *testing.T) {
+		var (
+			store = &fakeLeaseStorage{}
+			ttl   = 40 * time.Millisecond
+			slack = 200 * time.Millisecond
+
+			deadRepo = newFakeLeasedRepo(store)
+
+			liveClient = &fakeClient{}
+			liveRepo   = newFakeLeasedRepo(store)
+			liveKeeper = tokensync.NewTokenKeeper(liveClient).WithRepo(liveRepo).WithLeaseTTL(ttl)
+		)
+
+		// simulate a pod that acquired the lease and then crashed before it
+		// ever stored a token or renewed it
+		_, err := deadRepo.LockTTL(ctx, tokensync.DefaultKey, ttl)
+		require.NoError(t, err)
+
+		done := make(chan tokensync.Token, 1)
+		go func() { done <- liveKeeper.Token(tokensync.DefaultKey) }()
+
+		select {
+		case tok := <-done:
+			require.NoError(t, tok.Validate())
+			require.Equal(t, 1, liveClient.reqCount())
+		case <-time.After(ttl + slack):
+			t.Fatal("another keeper did not take over the stolen lease in time")
+		}
+	})
 
 	// test keep-alive, rather than waiting until a token fails to replace it
 	// establish rules for replacing it before it expires
 	// ensure that multiple pods do not try to replace it at the same time
+	// (see TestTokenKeeper_KeepAlive)
+}
+
+func TestTokenKeeper_CASRepo(t *testing.T) {
+	t.Run("a CASRepo is used to mint the first token instead of Lock/Unlock", func(t *testing.T) {
+		var (
+			client = &fakeClient{}
+			repo   = &fakeCASRepo{}
+			keeper = tokensync.NewTokenKeeper(client).WithRepo(repo)
+		)
+
+		tok := keeper.Token(tokensync.DefaultKey)
+		require.NoError(t, tok.Validate())
+		assert.Equal(t, 0, repo.lockAttempts(),
+			"a CASRepo should resolve get-or-create itself, never taking the Lock/Unlock round trip")
+	})
+
+	t.Run("the loser of a concurrent mint gets the winner's token instead of minting its own", func(t *testing.T) {
+		// calls GetOrCreate on the repo directly, bypassing TokenKeeper's own
+		// singleflight coalescing, so this actually exercises fakeCASRepo's
+		// own compare-and-swap rather than just the keeper's.
+		var (
+			repo      = &fakeCASRepo{}
+			mintCalls int32
+			newToken  = func() (tokensync.Token, error) {
+				atomic.AddInt32(&mintCalls, 1)
+				return newFakeToken(), nil
+			}
+
+			wg     sync.WaitGroup
+			tokens = make([]tokensync.Token, 20)
+		)
+
+		for i := range tokens {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				tok, err := repo.GetOrCreate(ctx, tokensync.DefaultKey, newToken)
+				require.NoError(t, err)
+				tokens[i] = tok
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 1; i < len(tokens); i++ {
+			require.Equal(t, tokens[0].String(), tokens[i].String())
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&mintCalls),
+			"every loser of the race should get the winner's token instead of minting its own")
+	})
+}
+
+func TestTokenKeeper_Watch(t *testing.T) {
+	// when the repo supports WatchableRepo, a token another pod stores
+	// should land in this keeper without it ever calling the client or
+	// taking the repo lock itself
+	t.Run("a pushed token is picked up without a client or lock call", func(t *testing.T) {
+		var (
+			client = &fakeClient{}
+			repo   = newFakeWatchableRepo()
+			keeper = tokensync.NewTokenKeeper(client).WithRepo(repo)
+			seed   = newFakeToken()
+			pushed = newFakeToken()
+			got    = make(chan tokensync.Token, 1)
+		)
+
+		// seed the repo so the first Token() call is served from there
+		// instead of the client, and subscribes this key's watch as a
+		// side effect
+		require.NoError(t, repo.StoreToken(ctx, tokensync.DefaultKey, seed))
+		first := keeper.Token(tokensync.DefaultKey)
+		require.Equal(t, seed.String(), first.String())
+		require.Equal(t, 0, client.reqCount())
+
+		repo.push(pushed)
+
+		// give the watch goroutine a moment to land the pushed token before
+		// the keeper is asked for one again, so we never fall through to
+		// repo lock/client fallback
+		time.Sleep(20 * time.Millisecond)
+		go func() { got <- keeper.Token(tokensync.DefaultKey) }()
+
+		select {
+		case tok := <-got:
+			assert.Equal(t, pushed.String(), tok.String())
+		case <-time.After(time.Second):
+			t.Fatal("keeper.Token() did not return")
+		}
+		assert.Equal(t, 0, client.reqCount())
+	})
+}
+
+func TestTokenKeeper_Claims(t *testing.T) {
+	type claims struct {
+		Sub string `json:"sub"`
+	}
+
+	t.Run("decodes a MetadataToken's metadata", func(t *testing.T) {
+		var (
+			repo  = &fakeMetadataRepo{}
+			token = tokensync.StoredToken{
+				Value:     uuid.NewString(),
+				CreatedAt: time.Now(),
+				ExpiresAt: time.Now().Add(time.Minute),
+				Metadata:  json.RawMessage(`{"sub":"tenant-a"}`),
+			}
+			keeper = tokensync.NewTokenKeeper(&fakeClient{}).WithRepo(repo)
+		)
+		require.NoError(t, repo.StoreToken(ctx, "tenant-a", token))
+
+		var c claims
+		require.NoError(t, keeper.Claims("tenant-a", &c))
+		assert.Equal(t, "tenant-a", c.Sub)
+	})
+
+	t.Run("errors when the token does not carry metadata", func(t *testing.T) {
+		keeper := tokensync.NewTokenKeeper(&fakeClient{})
+		var c claims
+		assert.Error(t, keeper.Claims(tokensync.DefaultKey, &c))
+	})
+
+	t.Run("uses a configured ClaimsUnmarshaler instead of json.Unmarshal", func(t *testing.T) {
+		var (
+			repo  = &fakeMetadataRepo{}
+			token = tokensync.StoredToken{
+				Value:     uuid.NewString(),
+				CreatedAt: time.Now(),
+				ExpiresAt: time.Now().Add(time.Minute),
+				Metadata:  json.RawMessage(`sub=tenant-b`),
+			}
+			called bool
+			keeper = tokensync.NewTokenKeeper(&fakeClient{}).
+				WithRepo(repo).
+				WithClaimsUnmarshaler(func(data []byte, target any) error {
+					called = true
+					return json.Unmarshal([]byte(`{"sub":"tenant-b"}`), target)
+				})
+		)
+		require.NoError(t, repo.StoreToken(ctx, "tenant-b", token))
+
+		var c claims
+		require.NoError(t, keeper.Claims("tenant-b", &c))
+		assert.True(t, called)
+		assert.Equal(t, "tenant-b", c.Sub)
+	})
 }
@@ -0,0 +1,74 @@
+package tk_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	tokensync "github.com/tempcke/tk"
+)
+
+// fakeCASRepo is a minimal tokensync.CASRepo: GetOrCreate resolves
+// get-or-create itself via a mutex standing in for a real CAS, so
+// lockAttempts should stay at 0 while a TokenKeeper backed by one only
+// mints its first token (a refresh still goes through Lock).
+type fakeCASRepo struct {
+	mu          sync.Mutex
+	tokens      map[string]tokensync.Token
+	lockAttempt int
+}
+
+func (r *fakeCASRepo) GetToken(_ context.Context, key string) (tokensync.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil || r.tokens[key] == nil {
+		return nil, errors.New("no token")
+	}
+	return r.tokens[key], nil
+}
+
+func (r *fakeCASRepo) StoreToken(_ context.Context, key string, token tokensync.Token) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil {
+		r.tokens = make(map[string]tokensync.Token)
+	}
+	r.tokens[key] = token
+	return nil
+}
+
+func (r *fakeCASRepo) Lock(context.Context, string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lockAttempt++
+	return nil
+}
+
+func (r *fakeCASRepo) Unlock(context.Context, string) error { return nil }
+
+func (r *fakeCASRepo) GetOrCreate(
+	ctx context.Context, key string, newToken func() (tokensync.Token, error),
+) (tokensync.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens != nil && r.tokens[key] != nil {
+		return r.tokens[key], nil
+	}
+	tok, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	if r.tokens == nil {
+		r.tokens = make(map[string]tokensync.Token)
+	}
+	r.tokens[key] = tok
+	return tok, nil
+}
+
+func (r *fakeCASRepo) lockAttempts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lockAttempt
+}
+
+var _ tokensync.CASRepo = (*fakeCASRepo)(nil)
@@ -2,29 +2,40 @@ package tk_test
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	tokensync "github.com/tempcke/tk"
 )
 
+// fakeClient's mu guards forcedErr/curToken/mintCount/refreshAttemptCount:
+// keepAliveLoop mutates them from its own goroutine while a test reads or
+// reassigns them from the test goroutine (e.g. via require.Eventually or a
+// direct client.setErr(nil) to simulate recovery).
 type fakeClient struct {
-	err      error
-	curToken *fakeToken
-	lag      time.Duration
-	reqCount int
+	mu                  sync.Mutex
+	forcedErr           error
+	curToken            *fakeToken
+	lag                 time.Duration
+	mintCount           int
+	refreshAttemptCount int
 }
 
-func (c *fakeClient) NewToken(_ context.Context) (tokensync.Token, error) {
-	if c.err != nil {
-		return nil, c.err
+func (c *fakeClient) NewToken(_ context.Context, _ string) (tokensync.Token, error) {
+	if err := c.err(); err != nil {
+		return nil, err
 	}
 	c.sleep()
 	return c.newFakeToken(), nil
 }
 
-func (c *fakeClient) RefreshToken(_ context.Context, _ tokensync.Token) (tokensync.Token, error) {
-	if c.err != nil {
-		return nil, c.err
+func (c *fakeClient) RefreshToken(_ context.Context, _ string, _ tokensync.Token) (tokensync.Token, error) {
+	c.mu.Lock()
+	c.refreshAttemptCount++
+	c.mu.Unlock()
+
+	if err := c.err(); err != nil {
+		return nil, err
 	}
 	c.sleep()
 	return c.newFakeToken(), nil
@@ -37,13 +48,18 @@ func (c *fakeClient) sleep() {
 }
 
 func (c *fakeClient) newFakeToken() *fakeToken {
-	c.reqCount++
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mintCount++
 	c.curToken = newFakeToken()
 	return c.curToken
 }
 
 func (c *fakeClient) expireToken() {
-	c.curToken.expireToken()
+	c.mu.Lock()
+	tok := c.curToken
+	c.mu.Unlock()
+	tok.expireToken()
 }
 
 func (c *fakeClient) withLag(lag time.Duration) *fakeClient {
@@ -51,3 +67,42 @@ func (c *fakeClient) withLag(lag time.Duration) *fakeClient {
 	return c
 }
 
+// err returns the error NewToken/RefreshToken should currently fail with,
+// or nil.
+func (c *fakeClient) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.forcedErr
+}
+
+// setErr makes NewToken/RefreshToken fail with err, or succeed again once
+// set back to nil.
+func (c *fakeClient) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forcedErr = err
+}
+
+// reqCount returns how many tokens this client has minted, across both
+// NewToken and RefreshToken.
+func (c *fakeClient) reqCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mintCount
+}
+
+// resetReqCount zeroes the mint count, for tests that only want to count
+// calls made after some point they've already set up.
+func (c *fakeClient) resetReqCount() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mintCount = 0
+}
+
+// refreshAttempts returns how many times RefreshToken has been called,
+// regardless of whether it succeeded.
+func (c *fakeClient) refreshAttempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refreshAttemptCount
+}
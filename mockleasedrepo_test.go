@@ -0,0 +1,115 @@
+package tk_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	tokensync "github.com/tempcke/tk"
+)
+
+// fakeLeaseStorage backs one or more fakeLeasedRepo instances that
+// represent independent pods coordinating lock ownership over the same
+// external store.
+type fakeLeaseStorage struct {
+	mu      sync.Mutex
+	token   *fakeToken
+	holder  string
+	ttl     time.Duration
+	expires time.Time
+}
+
+type fakeLeasedRepo struct {
+	dataStore *fakeLeaseStorage
+	lag       time.Duration
+}
+
+func newFakeLeasedRepo(store *fakeLeaseStorage) *fakeLeasedRepo {
+	return &fakeLeasedRepo{dataStore: store}
+}
+
+func (r *fakeLeasedRepo) withLag(lag time.Duration) *fakeLeasedRepo {
+	r.lag = lag
+	return r
+}
+
+func (r *fakeLeasedRepo) sleep() {
+	if r.lag > 0 {
+		time.Sleep(r.lag)
+	}
+}
+
+func (r *fakeLeasedRepo) GetToken(_ context.Context, _ string) (tokensync.Token, error) {
+	r.sleep()
+	r.dataStore.mu.Lock()
+	defer r.dataStore.mu.Unlock()
+	if r.dataStore.token == nil {
+		return nil, errors.New("no token")
+	}
+	return r.dataStore.token, nil
+}
+
+func (r *fakeLeasedRepo) StoreToken(_ context.Context, _ string, token tokensync.Token) error {
+	r.sleep()
+	r.dataStore.mu.Lock()
+	defer r.dataStore.mu.Unlock()
+	r.dataStore.token = &fakeToken{
+		val:     token.String(),
+		created: token.Created(),
+		expires: token.Expires(),
+		err:     token.Validate(),
+	}
+	return nil
+}
+
+// Lock/Unlock satisfy Repo but are unused while LockTTL is available.
+func (r *fakeLeasedRepo) Lock(_ context.Context, _ string) error   { return nil }
+func (r *fakeLeasedRepo) Unlock(_ context.Context, _ string) error { return nil }
+
+// LockTTL grants the lease to whoever observes it free or expired, using
+// the lease identity as the compare-and-swap guard so a dead holder that
+// never renews is eventually stolen from. key is unused since every test
+// exercising fakeLeasedRepo only ever manages one lease at a time.
+func (r *fakeLeasedRepo) LockTTL(_ context.Context, _ string, ttl time.Duration) (tokensync.Lease, error) {
+	r.sleep()
+	id := uuid.NewString()
+	for {
+		r.dataStore.mu.Lock()
+		free := r.dataStore.holder == "" || time.Now().After(r.dataStore.expires)
+		if free {
+			r.dataStore.holder = id
+			r.dataStore.ttl = ttl
+			r.dataStore.expires = time.Now().Add(ttl)
+			r.dataStore.mu.Unlock()
+			return &fakeLease{store: r.dataStore, id: id}, nil
+		}
+		r.dataStore.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeLease struct {
+	store *fakeLeaseStorage
+	id    string
+}
+
+func (l *fakeLease) Renew(_ context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.holder != l.id {
+		return errors.New("lease no longer held")
+	}
+	l.store.expires = time.Now().Add(l.store.ttl)
+	return nil
+}
+
+func (l *fakeLease) Release(_ context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.holder == l.id {
+		l.store.holder = ""
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package tk_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	tokensync "github.com/tempcke/tk"
+)
+
+// fakeMetadataRepo is a minimal Repo that stores tokens as-is, unlike
+// fakeRepo which normalizes every stored token into a *fakeToken. It
+// exists so tests can exercise a MetadataToken (e.g. tokensync.StoredToken)
+// round trip without losing its metadata.
+type fakeMetadataRepo struct {
+	mu     sync.Mutex
+	tokens map[string]tokensync.Token
+}
+
+func (r *fakeMetadataRepo) GetToken(_ context.Context, key string) (tokensync.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil || r.tokens[key] == nil {
+		return nil, errors.New("no token")
+	}
+	return r.tokens[key], nil
+}
+
+func (r *fakeMetadataRepo) StoreToken(_ context.Context, key string, token tokensync.Token) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil {
+		r.tokens = make(map[string]tokensync.Token)
+	}
+	r.tokens[key] = token
+	return nil
+}
+
+func (r *fakeMetadataRepo) Lock(context.Context, string) error   { return nil }
+func (r *fakeMetadataRepo) Unlock(context.Context, string) error { return nil }
@@ -27,18 +27,21 @@ func newFakePgRepo(pool *pgxpool.Pool) (*fakePgRepo, error) {
 	return repo, repo.up()
 }
 
-func (r *fakePgRepo) GetToken(ctx context.Context) (tokensync.Token, error) {
+func (r *fakePgRepo) GetToken(ctx context.Context, key string) (tokensync.Token, error) {
 	var (
-		token  fakeToken
-		_query = `SELECT ` + tokensync.Rows +
+		token    fakeToken
+		metadata []byte
+		_query   = `SELECT ` + tokensync.Rows +
 			` FROM ` + r.table +
+			` WHERE ` + tokensync.FieldKey + ` = $1` +
 			` ORDER BY ` + tokensync.FieldCreated +
 			` DESC LIMIT 1;`
 	)
-	if err := r.pool.QueryRow(ctx, _query).Scan(
+	if err := r.pool.QueryRow(ctx, _query, key).Scan(
 		&token.val,
 		&token.created,
 		&token.expires,
+		&metadata,
 	); err != nil {
 		return nil, err
 	}
@@ -46,16 +49,18 @@ func (r *fakePgRepo) GetToken(ctx context.Context) (tokensync.Token, error) {
 	return token, nil
 }
 
-func (r *fakePgRepo) StoreToken(ctx context.Context, token tokensync.Token) error {
+func (r *fakePgRepo) StoreToken(ctx context.Context, key string, token tokensync.Token) error {
 	var _query = `INSERT INTO   ` + r.table +
-		` (` + tokensync.Rows + `) ` +
-		`VALUES ($1, $2, $3);`
+		` (` + tokensync.FieldKey + `, ` + tokensync.Rows + `) ` +
+		`VALUES ($1, $2, $3, $4, $5);`
 	if _, err := r.pool.Exec(
 		ctx,
 		_query,
+		key,
 		token.String(),
 		token.Created(),
 		token.Expires(),
+		nil,
 	); err != nil {
 		return err
 	}
@@ -95,9 +100,11 @@ func (r *fakePgRepo) up() error {
 	if _, err := r.pool.Exec(
 		ctx,
 		`CREATE TABLE IF NOT EXISTS `+r.table+` (
+					key					varchar		default '`+tokensync.DefaultKey+`'			NOT NULL,
 					val					varchar												NOT NULL,
 					expires				timestamp											NOT NULL,
 					created				timestamp		default now()						NOT NULL,
+					metadata			jsonb,
 					PRIMARY KEY (val)
 				);`,
 	); err != nil {
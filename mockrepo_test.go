@@ -4,37 +4,59 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tokensync "github.com/tempcke/tk"
 )
 
 type fakeRepo struct {
-	dataStore *storage
-	lag       time.Duration
+	dataStore   *storage
+	lag         time.Duration
+	lockErr     error
+	lockAttempt int32
 }
 
-func (r *fakeRepo) GetToken(_ context.Context) (tokensync.Token, error) {
+func (r *fakeRepo) GetToken(_ context.Context, key string) (tokensync.Token, error) {
 	r.sleep()
-	if r.storage().token == nil {
+	tok := r.storage().getToken(key)
+	if tok == nil {
 		return nil, errors.New("no token")
 	}
-	return r.storage().token, nil
+	return tok, nil
 }
 
-func (r *fakeRepo) StoreToken(_ context.Context, token tokensync.Token) error {
+func (r *fakeRepo) StoreToken(_ context.Context, key string, token tokensync.Token) error {
 	r.sleep()
-	r.storage().token = &fakeToken{
+	r.storage().setToken(key, &fakeToken{
 		val:     token.String(),
 		created: token.Created(),
 		expires: token.Expires(),
 		err:     token.Validate(),
-	}
+	})
 	return nil
 }
 
-func (r *fakeRepo) Lock(ctx context.Context) error   { r.sleep(); return r.storage().Lock(ctx) }
-func (r *fakeRepo) Unlock(ctx context.Context) error { r.sleep(); return r.storage().Unlock(ctx) }
+func (r *fakeRepo) Lock(ctx context.Context, key string) error {
+	atomic.AddInt32(&r.lockAttempt, 1)
+	r.sleep()
+	if r.lockErr != nil {
+		return r.lockErr
+	}
+	return r.storage().Lock(ctx, key)
+}
+
+// lockAttempts returns how many times Lock has been called, for tests
+// asserting a caller backed off instead of retrying the lock in a tight
+// loop.
+func (r *fakeRepo) lockAttempts() int32 {
+	return atomic.LoadInt32(&r.lockAttempt)
+}
+
+func (r *fakeRepo) Unlock(ctx context.Context, key string) error {
+	r.sleep()
+	return r.storage().Unlock(ctx, key)
+}
 
 func (r *fakeRepo) storage() *storage {
 	if r.dataStore == nil {
@@ -59,14 +81,50 @@ func (r *fakeRepo) withStorage(s *storage) *fakeRepo {
 	return r
 }
 
+// withLockErr makes Lock fail with err, e.g. to simulate ErrLockTimeout.
+func (r *fakeRepo) withLockErr(err error) *fakeRepo {
+	r.lockErr = err
+	return r
+}
+
+// token returns the DefaultKey token, for tests that only ever exercise
+// one key.
 func (r *fakeRepo) token() *fakeToken {
-	return r.storage().token
+	return r.storage().getToken(tokensync.DefaultKey)
 }
 
 type storage struct {
-	token *fakeToken
-	lock  sync.Mutex
+	mu     sync.Mutex
+	tokens map[string]*fakeToken
+	locks  map[string]*sync.Mutex
+}
+
+func (s *storage) getToken(key string) *fakeToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[key]
+}
+
+func (s *storage) setToken(key string, t *fakeToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]*fakeToken)
+	}
+	s.tokens[key] = t
+}
+
+func (s *storage) keyLock(key string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locks == nil {
+		s.locks = make(map[string]*sync.Mutex)
+	}
+	if s.locks[key] == nil {
+		s.locks[key] = &sync.Mutex{}
+	}
+	return s.locks[key]
 }
 
-func (s *storage) Lock(_ context.Context) error   { s.lock.Lock(); return nil }
-func (s *storage) Unlock(_ context.Context) error { s.lock.Unlock(); return nil }
+func (s *storage) Lock(_ context.Context, key string) error   { s.keyLock(key).Lock(); return nil }
+func (s *storage) Unlock(_ context.Context, key string) error { s.keyLock(key).Unlock(); return nil }
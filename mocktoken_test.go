@@ -41,3 +41,8 @@ func (t *fakeToken) expireToken() {
 	t.expires = time.Now().Add(-2 * time.Minute)
 }
 
+func (t *fakeToken) withExpiresIn(d time.Duration) *fakeToken {
+	t.expires = time.Now().Add(d)
+	return t
+}
+
@@ -0,0 +1,32 @@
+package tk_test
+
+import (
+	"context"
+	"errors"
+
+	tokensync "github.com/tempcke/tk"
+)
+
+// fakeWatchableRepo is a fakeRepo that also implements tokensync.WatchableRepo,
+// emitting whatever token is pushed onto its events channel.
+type fakeWatchableRepo struct {
+	fakeRepo
+	events chan tokensync.Token
+}
+
+func newFakeWatchableRepo() *fakeWatchableRepo {
+	return &fakeWatchableRepo{events: make(chan tokensync.Token, 1)}
+}
+
+func (r *fakeWatchableRepo) Watch(_ context.Context, _ string) (<-chan tokensync.Token, error) {
+	if r.events == nil {
+		return nil, errors.New("no events channel")
+	}
+	return r.events, nil
+}
+
+func (r *fakeWatchableRepo) push(t tokensync.Token) {
+	r.events <- t
+}
+
+var _ tokensync.WatchableRepo = (*fakeWatchableRepo)(nil)
@@ -2,21 +2,48 @@ package tk
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
 	"github.com/jackc/pgx/v4/pgxpool"
-	"math/rand"
 )
 
 const (
 	DefaultTable = "token"
-	Rows         = `val, expires, created`
+	Rows         = `val, created, expires, metadata`
 	FieldCreated = `created`
+	FieldKey     = `key`
+
+	// DefaultChannel is the pg_notify channel StoreToken notifies on and
+	// Watch listens on.
+	DefaultChannel = "tokensync_token_updates"
+
+	// DefaultLockPollInterval is how often Lock retries pg_try_advisory_lock
+	// while the lock is held elsewhere, used when WithLockPollInterval is
+	// not called.
+	DefaultLockPollInterval = 50 * time.Millisecond
 )
 
+// ErrLockTimeout is returned by Lock when ctx is done before
+// pg_try_advisory_lock succeeds.
+var ErrLockTimeout = errors.New("timed out waiting for advisory lock")
+
 type PgRepo struct {
-	pool       *pgxpool.Pool
-	table      string
-	lockNumber int
+	pool    *pgxpool.Pool
+	table   string
+	channel string
+
+	lockPollInterval time.Duration
+
+	// conns holds the connection Lock pinned for key, so Unlock releases
+	// the advisory lock on the same session that took it: pg_advisory_lock
+	// is session-scoped, so calling pg_advisory_unlock on a different
+	// pooled connection would silently do nothing and leak the lock.
+	conns   map[string]*pgxpool.Conn
+	connsMu sync.Mutex
 }
 
 func NewPgRepo(pool *pgxpool.Pool) (*PgRepo, error) {
@@ -25,22 +52,33 @@ func NewPgRepo(pool *pgxpool.Pool) (*PgRepo, error) {
 	}
 
 	return &PgRepo{
-		pool:       pool,
-		table:      DefaultTable,
-		lockNumber: rand.Intn(100),
+		pool:             pool,
+		table:            DefaultTable,
+		channel:          DefaultChannel,
+		lockPollInterval: DefaultLockPollInterval,
+		conns:            make(map[string]*pgxpool.Conn),
 	}, nil
 }
 
-func (r *PgRepo) GetToken(ctx context.Context) (Token, error) {
+// WithLockPollInterval overrides how often Lock retries pg_try_advisory_lock
+// while waiting for it to become available. Defaults to
+// DefaultLockPollInterval.
+func (r *PgRepo) WithLockPollInterval(d time.Duration) *PgRepo {
+	r.lockPollInterval = d
+	return r
+}
+
+func (r *PgRepo) GetToken(ctx context.Context, key string) (Token, error) {
 	var (
-		token  Token
+		token  StoredToken
 		_query = `SELECT ` + Rows +
 			` FROM ` + r.table +
+			` WHERE ` + FieldKey + ` = $1` +
 			` ORDER BY ` + FieldCreated +
 			` DESC LIMIT 1;`
 	)
-	if err := r.pool.QueryRow(ctx, _query).Scan(
-		&token, //FIXME
+	if err := r.pool.QueryRow(ctx, _query, key).Scan(
+		&token.Value, &token.CreatedAt, &token.ExpiresAt, &token.Metadata,
 	); err != nil {
 		return nil, err
 	}
@@ -48,33 +86,203 @@ func (r *PgRepo) GetToken(ctx context.Context) (Token, error) {
 	return token, nil
 }
 
-func (r *PgRepo) StoreToken(ctx context.Context, token Token) error {
+func (r *PgRepo) StoreToken(ctx context.Context, key string, token Token) error {
+	var meta json.RawMessage
+	if mt, ok := token.(MetadataToken); ok {
+		meta = mt.TokenMetadata()
+	}
+
 	var _query = `INSERT INTO   ` + r.table +
-		` (` + Rows + `) ` +
-		`VALUES ($1, $2, $3);`
+		` (` + FieldKey + `, ` + Rows + `) ` +
+		`VALUES ($1, $2, $3, $4, $5);`
 	if _, err := r.pool.Exec(
 		ctx,
 		_query,
+		key,
 		token.String(),
 		token.Created(),
 		token.Expires(),
+		meta,
 	); err != nil {
 		return err
 	}
 
+	r.notify(ctx, key, token)
+
 	return nil
 }
 
-func (r *PgRepo) Lock(ctx context.Context) error {
-	if _, err := r.pool.Exec(ctx, `SELECT pg_advisory_lock($1);`, r.lockNumber); err != nil {
+// MigrateAddKey ALTERs an existing table (created before the key column
+// existed) to add it, backfilling DefaultKey into every pre-existing row
+// so GetToken/StoreToken calls made without changing the caller keep
+// finding the same rows.
+func (r *PgRepo) MigrateAddKey(ctx context.Context) error {
+	if _, err := r.pool.Exec(ctx, `ALTER TABLE `+r.table+
+		` ADD COLUMN IF NOT EXISTS `+FieldKey+` varchar NOT NULL DEFAULT '`+DefaultKey+`';`); err != nil {
 		return err
 	}
+	return nil
+}
 
+// MigrateAddMetadata ALTERs an existing table (created before the metadata
+// column existed) to add it, nullable, so GetToken/StoreToken calls against
+// it don't error over a missing column; pre-existing rows simply have no
+// metadata until next written.
+func (r *PgRepo) MigrateAddMetadata(ctx context.Context) error {
+	if _, err := r.pool.Exec(ctx, `ALTER TABLE `+r.table+
+		` ADD COLUMN IF NOT EXISTS metadata jsonb;`); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (r *PgRepo) Unlock(ctx context.Context) error {
-	if _, err := r.pool.Exec(ctx, `SELECT pg_advisory_unlock($1);`, r.lockNumber); err != nil {
+// notifyPayload is the JSON body carried by pg_notify, letting Watch
+// rebuild a usable Token without a round trip back to the table.
+type notifyPayload struct {
+	Key       string    `json:"key"`
+	Val       string    `json:"val"`
+	CreatedAt time.Time `json:"created"`
+	ExpiresAt time.Time `json:"expires"`
+}
+
+func (r *PgRepo) notify(ctx context.Context, key string, token Token) {
+	raw, err := json.Marshal(notifyPayload{
+		Key:       key,
+		Val:       token.String(),
+		CreatedAt: token.Created(),
+		ExpiresAt: token.Expires(),
+	})
+	if err != nil {
+		return
+	}
+	// best-effort: a missed notification just means watchers fall back to
+	// their own poll/lock cycle
+	_, _ = r.pool.Exec(ctx, `SELECT pg_notify($1, $2);`, r.channel, string(raw))
+}
+
+// Watch implements tokensync.WatchableRepo via LISTEN/NOTIFY: it pins a
+// connection, issues LISTEN, and emits a Token for every notification
+// StoreToken fires for key until ctx is done.
+func (r *PgRepo) Watch(ctx context.Context, key string) (<-chan Token, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, `LISTEN `+r.channel+`;`); err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	ch := make(chan Token)
+	go func() {
+		defer conn.Release()
+		defer close(ch)
+		for {
+			notification, err := conn.Conn().WaitForNotification(ctx)
+			if err != nil {
+				return
+			}
+
+			var payload notifyPayload
+			if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+				continue
+			}
+			if payload.Key != key {
+				continue
+			}
+
+			select {
+			case ch <- notifiedToken(payload):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+type notifiedToken notifyPayload
+
+func (t notifiedToken) String() string     { return t.Val }
+func (t notifiedToken) Created() time.Time { return t.CreatedAt }
+func (t notifiedToken) Expires() time.Time { return t.ExpiresAt }
+func (t notifiedToken) Validate() error    { return nil }
+
+// lockNumber derives a deterministic pg_advisory_lock key from table and
+// key via fnv-32a, instead of the random number an earlier version picked
+// once at construction: a random choice could differ between two PgRepo
+// instances (different pods, or different keepers in the same process)
+// backing the *same* table+key, so they wouldn't exclude each other, or give
+// two different table+key pairs the same lock number by chance, while a hash
+// of table+key gives every pod the same number for a given pair and makes it
+// unlikely (though, for a 32-bit hash, not impossible) that two pairs share one.
+// table is included so two PgRepo instances backing unrelated tables don't
+// contend on the same advisory lock just because they share a tenant key
+// (e.g. both using DefaultKey).
+func lockNumber(table, key string) int32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(table + "/" + key))
+	return int32(h.Sum32())
+}
+
+// Lock polls pg_try_advisory_lock on a connection pinned for the duration
+// of the hold (instead of blocking forever in pg_advisory_lock, which
+// ignores ctx cancellation: pgx can only ask the server to cancel the
+// query, not release a lock the session already holds) until it succeeds
+// or ctx is done, in which case it returns ErrLockTimeout.
+func (r *PgRepo) Lock(ctx context.Context, key string) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ErrLockTimeout
+		}
+		return err
+	}
+
+	ticker := time.NewTicker(r.lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var locked bool
+		if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1);`, lockNumber(r.table, key)).Scan(&locked); err != nil {
+			conn.Release()
+			if ctx.Err() != nil {
+				return ErrLockTimeout
+			}
+			return err
+		}
+		if locked {
+			r.connsMu.Lock()
+			r.conns[key] = conn
+			r.connsMu.Unlock()
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			conn.Release()
+			return ErrLockTimeout
+		}
+	}
+}
+
+// Unlock releases the advisory lock Lock acquired for key on the
+// connection Lock pinned, and returns that connection to the pool. A no-op
+// if this PgRepo never locked key (e.g. Lock timed out).
+func (r *PgRepo) Unlock(ctx context.Context, key string) error {
+	r.connsMu.Lock()
+	conn := r.conns[key]
+	delete(r.conns, key)
+	r.connsMu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1);`, lockNumber(r.table, key)); err != nil {
 		return err
 	}
 
@@ -86,7 +294,7 @@ func (r *PgRepo) withTable(table string) *PgRepo {
 	return r
 }
 
-func (r *PgRepo) withLockNumber(lockNumber int) *PgRepo {
-	r.lockNumber = lockNumber
+func (r *PgRepo) withChannel(channel string) *PgRepo {
+	r.channel = channel
 	return r
 }
@@ -1,15 +1,21 @@
 package tk_test
 
 import (
+	"context"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	tokensync "github.com/tempcke/tk"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestPgRepo(t *testing.T) {
 	var token tokensync.Token
 
+	key := "pgrepo-" + uuid.NewString()
+
 	err := os.Setenv(tokensync.DatabaseURL, "postgresql://actourex@localhost:5432/actourex")
 	assert.Nil(t, err)
 
@@ -22,21 +28,21 @@ func TestPgRepo(t *testing.T) {
 	defer repo.down()
 
 	t.Run("get token from pg repo storage when there are no tokens", func(t *testing.T) {
-		_, err = repo.GetToken(ctx)
+		_, err = repo.GetToken(ctx, key)
 		assert.NotNil(t, err)
 	})
 
 	t.Run("store token into pg repo storage", func(t *testing.T) {
-		err = repo.StoreToken(ctx, newFakeToken())
+		err = repo.StoreToken(ctx, key, newFakeToken())
 		assert.Nil(t, err)
 	})
 
 	t.Run("get latest valid token from pg repo storage", func(t *testing.T) {
 		newToken := newFakeToken()
-		err = repo.StoreToken(ctx, newToken)
+		err = repo.StoreToken(ctx, key, newToken)
 		assert.Nil(t, err)
 
-		token, err = repo.GetToken(ctx)
+		token, err = repo.GetToken(ctx, key)
 		assert.Nil(t, err)
 		assert.NotNil(t, token)
 		assert.Equal(t, newToken.String(), token.String())
@@ -54,3 +60,32 @@ func TestPgRepo(t *testing.T) {
 		assert.Nil(t, err)
 	})
 }
+
+// TestPgRepo_LockTimeout exercises the real tokensync.PgRepo (not
+// fakePgRepo, which still blocks forever in pg_advisory_lock): one repo
+// holds the lock for a key, and a second repo contending for that same key
+// must give up with ErrLockTimeout once ctx is done, instead of hanging.
+func TestPgRepo_LockTimeout(t *testing.T) {
+	err := os.Setenv(tokensync.DatabaseURL, "postgresql://actourex@localhost:5432/actourex")
+	assert.Nil(t, err)
+
+	pool, err := tokensync.GetPool(ctx)
+	assert.Nil(t, err)
+
+	key := "locktimeout-" + uuid.NewString()
+
+	holder, err := tokensync.NewPgRepo(pool)
+	require.NoError(t, err)
+	require.NoError(t, holder.Lock(ctx, key))
+	defer holder.Unlock(ctx, key)
+
+	contender, err := tokensync.NewPgRepo(pool)
+	require.NoError(t, err)
+	contender = contender.WithLockPollInterval(10 * time.Millisecond)
+
+	lockCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	err = contender.Lock(lockCtx, key)
+	assert.ErrorIs(t, err, tokensync.ErrLockTimeout)
+}
@@ -0,0 +1,266 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	tokensync "github.com/tempcke/tk"
+)
+
+const (
+	// DefaultKey is the redis key the token is stored under as a JSON blob.
+	DefaultKey = "tokensync:token"
+	// DefaultLockKey is the redis key used for the Redlock-style lock.
+	DefaultLockKey = "tokensync:lock"
+	// DefaultLockTTL bounds how long a lock may be held before it expires
+	// and becomes eligible to be acquired by someone else.
+	DefaultLockTTL = 30 * time.Second
+	// DefaultChannel is the pub/sub channel StoreToken publishes to and
+	// Watch subscribes to.
+	DefaultChannel = "tokensync:token:updates"
+
+	lockPollInterval = 50 * time.Millisecond
+)
+
+// ErrNoToken is returned by GetToken when no token has been stored yet.
+var ErrNoToken = errors.New("redis: no token stored")
+
+// RedisRepo implements tokensync.Repo on top of go-redis, storing the
+// token as a JSON blob and using the standard SET NX PX + fencing token
+// recipe for Lock/Unlock.
+type RedisRepo struct {
+	client      *goredis.Client
+	key         string
+	lockKey     string
+	lockTTL     time.Duration
+	lockTimeout time.Duration
+	channel     string
+
+	lockVals   map[string]string
+	lockValsMu sync.Mutex
+}
+
+// Option configures a RedisRepo built with NewRedisRepo.
+type Option func(*RedisRepo)
+
+// WithKey overrides the redis key the token is stored under.
+func WithKey(key string) Option { return func(r *RedisRepo) { r.key = key } }
+
+// WithLockKey overrides the redis key used for the Redlock-style lock.
+func WithLockKey(lockKey string) Option { return func(r *RedisRepo) { r.lockKey = lockKey } }
+
+// WithTTL overrides how long a lock may be held before it expires and
+// becomes eligible to be acquired by someone else.
+func WithTTL(ttl time.Duration) Option { return func(r *RedisRepo) { r.lockTTL = ttl } }
+
+// WithLockTimeout bounds how long Lock will poll for the lock before giving
+// up with an error, instead of retrying until ctx is done.
+func WithLockTimeout(d time.Duration) Option { return func(r *RedisRepo) { r.lockTimeout = d } }
+
+// NewRedisRepo wraps an existing go-redis client.
+func NewRedisRepo(client *goredis.Client, opts ...Option) (*RedisRepo, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+
+	r := &RedisRepo{
+		client:  client,
+		key:     DefaultKey,
+		lockKey: DefaultLockKey,
+		lockTTL: DefaultLockTTL,
+		channel: DefaultChannel,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// storedToken is the JSON shape persisted in redis, matching
+// tokensync.Token's val/created/expires fields.
+type storedToken struct {
+	Val       string    `json:"val"`
+	CreatedAt time.Time `json:"created"`
+	ExpiresAt time.Time `json:"expires"`
+}
+
+func (t storedToken) String() string     { return t.Val }
+func (t storedToken) Created() time.Time { return t.CreatedAt }
+func (t storedToken) Expires() time.Time { return t.ExpiresAt }
+func (t storedToken) Validate() error    { return nil }
+
+func (r *RedisRepo) GetToken(ctx context.Context, key string) (tokensync.Token, error) {
+	raw, err := r.client.Get(ctx, r.keyFor(key)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var token storedToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *RedisRepo) StoreToken(ctx context.Context, key string, token tokensync.Token) error {
+	raw, err := json.Marshal(storedToken{
+		Val:       token.String(),
+		CreatedAt: token.Created(),
+		ExpiresAt: token.Expires(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := r.client.Set(ctx, r.keyFor(key), raw, 0).Err(); err != nil {
+		return err
+	}
+
+	// best-effort: a missed publish just means watchers fall back to
+	// their own poll/lock cycle
+	r.client.Publish(ctx, r.channelFor(key), raw)
+	return nil
+}
+
+// keyFor namespaces the redis key a token is stored under by the
+// tokensync key it belongs to, so one RedisRepo can serve many named
+// tokens without their values colliding.
+func (r *RedisRepo) keyFor(key string) string { return r.key + ":" + key }
+
+// lockKeyFor namespaces the redis lock key the same way keyFor namespaces
+// the token key, so locking token A never blocks token B.
+func (r *RedisRepo) lockKeyFor(key string) string { return r.lockKey + ":" + key }
+
+// channelFor namespaces the redis pub/sub channel the same way keyFor
+// namespaces the token key, so Watch only ever hears about the key it was
+// asked to watch.
+func (r *RedisRepo) channelFor(key string) string { return r.channel + ":" + key }
+
+// Watch implements tokensync.WatchableRepo via redis pub/sub: it
+// subscribes to the channel StoreToken publishes to for key and emits a
+// Token for every message until ctx is done.
+func (r *RedisRepo) Watch(ctx context.Context, key string) (<-chan tokensync.Token, error) {
+	sub := r.client.Subscribe(ctx, r.channelFor(key))
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+
+	ch := make(chan tokensync.Token)
+	go func() {
+		defer close(ch)
+		defer sub.Close()
+		for {
+			select {
+			case msg, ok := <-sub.Channel():
+				if !ok {
+					return
+				}
+				var token storedToken
+				if err := json.Unmarshal([]byte(msg.Payload), &token); err != nil {
+					continue
+				}
+				select {
+				case ch <- token:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// unlockScript only deletes the lock key if it still holds the value this
+// caller set, so a caller never releases a lease it doesn't own anymore
+// (e.g. after its lock expired and another holder took over).
+var unlockScript = goredis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+else
+	return 0
+end
+`)
+
+// Lock blocks, polling at lockPollInterval, until it acquires the redis
+// lock for key, ctx is done, or lockTimeout elapses (if set via
+// WithLockTimeout).
+func (r *RedisRepo) Lock(ctx context.Context, key string) error {
+	if r.lockTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.lockTimeout)
+		defer cancel()
+	}
+
+	lockKey := r.lockKeyFor(key)
+	for {
+		fence, err := randomFence()
+		if err != nil {
+			return err
+		}
+
+		ok, err := r.client.SetNX(ctx, lockKey, fence, r.lockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.setLockVal(key, fence)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+func (r *RedisRepo) Unlock(ctx context.Context, key string) error {
+	fence := r.lockVal(key)
+	if fence == "" {
+		return nil
+	}
+	r.setLockVal(key, "")
+	return unlockScript.Run(ctx, r.client, []string{r.lockKeyFor(key)}, fence).Err()
+}
+
+func (r *RedisRepo) lockVal(key string) string {
+	r.lockValsMu.Lock()
+	defer r.lockValsMu.Unlock()
+	return r.lockVals[key]
+}
+
+func (r *RedisRepo) setLockVal(key, fence string) {
+	r.lockValsMu.Lock()
+	defer r.lockValsMu.Unlock()
+	if r.lockVals == nil {
+		r.lockVals = make(map[string]string)
+	}
+	if fence == "" {
+		delete(r.lockVals, key)
+		return
+	}
+	r.lockVals[key] = fence
+}
+
+func randomFence() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,111 @@
+package redis_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tokensync "github.com/tempcke/tk"
+	tkredis "github.com/tempcke/tk/redis"
+)
+
+func TestRedisRepo(t *testing.T) {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not set")
+	}
+
+	ctx := context.Background()
+
+	// RedisRepo stores each token (and its lock) under its key + ":" + the
+	// tokensync key
+	storedKey := tkredis.DefaultKey + ":" + tokensync.DefaultKey
+
+	opt, err := goredis.ParseURL(url)
+	require.NoError(t, err)
+	client := goredis.NewClient(opt)
+	defer client.Close()
+	defer client.Del(ctx, storedKey, tkredis.DefaultLockKey+":"+tokensync.DefaultKey)
+
+	repo, err := tkredis.NewRedisRepo(client)
+	require.NoError(t, err)
+
+	t.Run("get token from repo storage when there are no tokens", func(t *testing.T) {
+		client.Del(ctx, storedKey)
+		_, err := repo.GetToken(ctx, tokensync.DefaultKey)
+		assert.ErrorIs(t, err, tkredis.ErrNoToken)
+	})
+
+	t.Run("store and get a token", func(t *testing.T) {
+		tok := newFakeToken()
+		require.NoError(t, repo.StoreToken(ctx, tokensync.DefaultKey, tok))
+
+		got, err := repo.GetToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+		assert.Equal(t, tok.String(), got.String())
+		assert.Equal(t, tok.Expires().Unix(), got.Expires().Unix())
+	})
+
+	t.Run("lock then unlock", func(t *testing.T) {
+		require.NoError(t, repo.Lock(ctx, tokensync.DefaultKey))
+		require.NoError(t, repo.Unlock(ctx, tokensync.DefaultKey))
+	})
+
+	t.Run("WithKey isolates storage from the default key", func(t *testing.T) {
+		defer client.Del(ctx, "tokensync:token:custom:"+tokensync.DefaultKey)
+
+		custom, err := tkredis.NewRedisRepo(client, tkredis.WithKey("tokensync:token:custom"))
+		require.NoError(t, err)
+
+		tok := newFakeToken()
+		require.NoError(t, custom.StoreToken(ctx, tokensync.DefaultKey, tok))
+
+		client.Del(ctx, storedKey)
+		_, err = repo.GetToken(ctx, tokensync.DefaultKey)
+		assert.ErrorIs(t, err, tkredis.ErrNoToken)
+
+		got, err := custom.GetToken(ctx, tokensync.DefaultKey)
+		require.NoError(t, err)
+		assert.Equal(t, tok.String(), got.String())
+	})
+
+	t.Run("WithLockTimeout gives up instead of waiting forever", func(t *testing.T) {
+		defer client.Del(ctx, "tokensync:lock:custom:"+tokensync.DefaultKey)
+
+		held, err := tkredis.NewRedisRepo(client, tkredis.WithLockKey("tokensync:lock:custom"))
+		require.NoError(t, err)
+		require.NoError(t, held.Lock(ctx, tokensync.DefaultKey))
+		defer held.Unlock(ctx, tokensync.DefaultKey)
+
+		impatient, err := tkredis.NewRedisRepo(client,
+			tkredis.WithLockKey("tokensync:lock:custom"), tkredis.WithLockTimeout(100*time.Millisecond))
+		require.NoError(t, err)
+
+		err = impatient.Lock(ctx, tokensync.DefaultKey)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+type fakeToken struct {
+	val     string
+	created time.Time
+	expires time.Time
+}
+
+func newFakeToken() fakeToken {
+	return fakeToken{
+		val:     "tok-" + time.Now().Format(time.RFC3339Nano),
+		created: time.Now(),
+		expires: time.Now().Add(time.Minute),
+	}
+}
+
+func (t fakeToken) String() string     { return t.val }
+func (t fakeToken) Created() time.Time { return t.created }
+func (t fakeToken) Expires() time.Time { return t.expires }
+func (t fakeToken) Validate() error    { return nil }
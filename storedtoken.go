@@ -0,0 +1,47 @@
+package tk
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StoredToken implements Token over the val/created/expires/metadata shape
+// a Repo persists, with Metadata free for a caller to stash arbitrary
+// claims in (e.g. the payload a JWT token was minted from) without the
+// Repo needing to know their structure.
+//
+// Its fields can't be named Created/Expires/String/Validate like the
+// Token methods they back (a type can't have a field and a method of the
+// same name), so it follows the CreatedAt/ExpiresAt naming already used
+// by the redis/etcd/pg storedToken/notifyPayload types in this repo.
+type StoredToken struct {
+	Value     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Metadata  json.RawMessage
+}
+
+func (t StoredToken) String() string                 { return t.Value }
+func (t StoredToken) Created() time.Time             { return t.CreatedAt }
+func (t StoredToken) Expires() time.Time             { return t.ExpiresAt }
+func (t StoredToken) Validate() error                { return nil }
+func (t StoredToken) TokenMetadata() json.RawMessage { return t.Metadata }
+
+var (
+	_ Token         = StoredToken{}
+	_ MetadataToken = StoredToken{}
+)
+
+// MetadataToken is an optional capability a Token may implement to carry
+// arbitrary claims/metadata alongside the standard val/created/expires
+// fields. A Repo that persists metadata (e.g. PgRepo) type-asserts on this
+// to find something to write; TokenKeeper.Claims type-asserts on it to
+// find something to decode.
+type MetadataToken interface {
+	Token
+	TokenMetadata() json.RawMessage
+}
+
+// ClaimsUnmarshaler decodes a MetadataToken's raw metadata into target,
+// used by TokenKeeper.Claims. Defaults to json.Unmarshal.
+type ClaimsUnmarshaler func(data []byte, target interface{}) error